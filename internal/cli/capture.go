@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/serial"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// CaptureOpt 是一次采集的设置
+type CaptureOpt struct {
+	Port     string
+	Baud     int
+	Board    uint8
+	Format   string        // csv 或 json
+	Duration time.Duration // 为0时直到 Ctrl-C
+}
+
+// 每隔多久看一眼串口是否还在
+const linkCheckInterval = 500 * time.Millisecond
+
+// Capture 是 capture 子命令：订阅变量，把采样写到标准输出或文件，返回退出码
+func Capture(args []string) int {
+	fs := flag.NewFlagSet("capture", flag.ContinueOnError)
+	opt := CaptureOpt{}
+	link := linkFlags{}
+	out := ""
+	link.register(fs)
+	fs.StringVar(&opt.Format, "format", "csv", "output format: csv or json")
+	fs.StringVar(&out, "o", "", "output file, stdout if empty")
+	fs.DurationVar(&opt.Duration, "d", 0, "capture duration, until Ctrl-C if 0")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: asuwave capture -port PORT -elf FILE [options] NAME...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	names := fs.Args()
+	if err := link.check(); err != nil || len(names) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if opt.Format != "csv" && opt.Format != "json" {
+		fmt.Fprintln(os.Stderr, "unknown format:", opt.Format)
+		return exitUsage
+	}
+	opt.Port = link.port
+	opt.Baud = link.baud
+	opt.Board = uint8(link.board)
+
+	vars, err := link.resolveAll(names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		defer f.Close()
+		w = f
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	if err := capture(opt, vars, w, stop); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitLink
+	}
+	return exitOK
+}
+
+// sampleWriter 把采样逐行写出
+type sampleWriter interface {
+	Write(c variable.ChartT) error
+	Flush() error
+}
+
+type csvWriter struct{ w *csv.Writer }
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{csv.NewWriter(w)}
+	return c, c.w.Write([]string{"Port", "Board", "Name", "Tick", "Data"})
+}
+
+func (c *csvWriter) Write(v variable.ChartT) error {
+	return c.w.Write([]string{
+		v.Port,
+		strconv.Itoa(int(v.Board)),
+		v.Name,
+		strconv.FormatUint(uint64(v.Tick), 10),
+		strconv.FormatFloat(v.Data, 'g', -1, 64),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonWriter struct{ e *json.Encoder }
+
+func (j *jsonWriter) Write(v variable.ChartT) error { return j.e.Encode(v) }
+
+func (j *jsonWriter) Flush() error { return nil }
+
+// capture 打开串口订阅 vars，直到时间到或收到 stop；连接出错时返回错误
+func capture(opt CaptureOpt, vars []variable.T, w io.Writer, stop <-chan os.Signal) error {
+	var sw sampleWriter
+	if opt.Format == "json" {
+		sw = &jsonWriter{json.NewEncoder(w)}
+	} else {
+		c, err := newCSVWriter(w)
+		if err != nil {
+			return err
+		}
+		sw = c
+	}
+
+	if err := open(opt.Port, opt.Baud, opt.Board); err != nil {
+		return err
+	}
+	defer serial.CloseAll()
+
+	// 经由指针的变量，先读出指针才知道订阅哪里
+	m := map[variable.Key]variable.T{}
+	for _, v := range vars {
+		addr, err := serial.Deref(v, readTimeout)
+		if err != nil {
+			return fmt.Errorf("%s: %w", v.Name, err)
+		}
+		v.Addr = addr
+		m[variable.KeyOf(v)] = v
+	}
+	variable.UseAll(variable.RD, m)
+	glog.Infoln("Capture started:", opt.Port, len(vars), "vars")
+
+	var timeout <-chan time.Time
+	if opt.Duration > 0 {
+		timeout = time.After(opt.Duration)
+	}
+	tick := time.NewTicker(linkCheckInterval)
+	defer tick.Stop()
+
+	count := 0
+	for {
+		select {
+		case <-stop:
+			return finish(sw, count)
+		case <-timeout:
+			return finish(sw, count)
+
+		case s := <-serial.Chch:
+			chart := []variable.ChartT{}
+			if err := json.Unmarshal([]byte(s), &chart); err != nil {
+				return err
+			}
+			for _, c := range chart {
+				if err := sw.Write(c); err != nil {
+					return err
+				}
+				count++
+			}
+			if err := sw.Flush(); err != nil {
+				return err
+			}
+
+		case s := <-serial.ChStatus:
+			// 单片机不认得这些变量，采不到了；订阅满了会重试，取消不存在的订阅也不要紧
+			st := serial.StatusT{}
+			json.Unmarshal([]byte(s), &st)
+			e := variable.MCUError{Code: st.Code, Act: st.Act}
+			if st.Act != variable.Subscribe || !e.Permanent() || !captured(m, st.Board, st.Addr) {
+				glog.Warningln("Capture ignored status:", s)
+				continue
+			}
+			sw.Flush()
+			return fmt.Errorf("board %d addr 0x%08x: %s", st.Board, st.Addr, st.Error)
+
+		case <-tick.C:
+			for _, p := range serial.List() {
+				if p.State != serial.PortOpen {
+					sw.Flush()
+					return errors.New("link lost: " + p.Serial)
+				}
+			}
+		}
+	}
+}
+
+// captured 判断板子上的地址是不是正在采集的变量
+func captured(m map[variable.Key]variable.T, board uint8, addr uint32) bool {
+	for _, v := range m {
+		if v.Board == board && v.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// finish 收尾，一个采样都没收到也算连接出错
+func finish(sw sampleWriter, count int) error {
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	glog.Infoln("Capture done:", count, "samples")
+	if count == 0 {
+		return errors.New("no sample received")
+	}
+	return nil
+}
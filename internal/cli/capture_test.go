@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scutrobotlab/asuwave/internal/serial"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+func TestResolve(t *testing.T) {
+	projs := variable.Projs{
+		"a": {Addr: "0x40010000", Name: "a", Type: "float"},
+		"b": {Addr: "bad", Name: "b", Type: "float"},
+	}
+	v, err := resolve(projs, 2, "a")
+	if err != nil || v.Addr != 0x40010000 || v.Board != 2 || v.Type != "float" {
+		t.Errorf("resolve a: %v %v", v, err)
+	}
+	if _, err := resolve(projs, 1, "b"); err == nil {
+		t.Error("bad address accepted")
+	}
+	if _, err := resolve(projs, 1, "c"); err == nil {
+		t.Error("unknown variable accepted")
+	}
+}
+
+func TestCapture(t *testing.T) {
+	vars := []variable.T{
+		{Board: 1, Name: "a", Type: "float", Addr: 0x40010000, SignalGain: 1},
+	}
+	// 订阅满了会重试，取消不存在的订阅也不要紧，都不该中断采集
+	for _, st := range []serial.StatusT{
+		{Board: 1, Addr: 0x40010000, Act: variable.Subscribe, Code: variable.FullAddr},
+		{Board: 1, Addr: 0x40010000, Act: variable.Unsubscribe, Code: variable.NoSuchAddrReg},
+		{Board: 1, Addr: 0x50000000, Act: variable.Subscribe, Code: variable.NoSuchAddr},
+	} {
+		b, _ := json.Marshal(st)
+		serial.ChStatus <- string(b)
+	}
+
+	b := &strings.Builder{}
+	opt := CaptureOpt{Port: "Test port", Board: 1, Format: "csv", Duration: 1500 * time.Millisecond}
+	if err := capture(opt, vars, b, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 || strings.Join(rows[0], ",") != "Port,Board,Name,Tick,Data" {
+		t.Fatalf("rows %v", rows)
+	}
+	if rows[1][0] != "Test port" || rows[1][2] != "a" {
+		t.Errorf("row %v", rows[1])
+	}
+
+	// 板子不认得的地址，应当报错
+	vars[0].Addr = 0x10000000
+	opt.Format = "json"
+	if err := capture(opt, vars, &strings.Builder{}, make(chan os.Signal)); err == nil {
+		t.Error("link error not reported")
+	}
+}
+
+func TestCaptureBatch(t *testing.T) {
+	serial.SetOptProtocolV2(true)
+	defer serial.SetOptProtocolV2(false)
+	defer variable.UseAll(variable.RD, map[variable.Key]variable.T{}) // 别让后面的测试继续订阅
+
+	// v2 握手后订阅数据以批量帧到达，每个变量和整块订阅的每个成员都应当有采样
+	vars := []variable.T{
+		{Board: 1, Name: "a", Type: "float", Addr: 0x40010000, SignalGain: 1},
+		{Board: 1, Name: "b", Type: "int16_t", Addr: 0x60010000, SignalGain: 1},
+		{Board: 1, Name: "v", Type: "[3]double", Addr: 0x30020000, SignalGain: 1, Fields: []variable.FieldT{
+			{Name: "[0]", Offset: 0, Type: "double"},
+			{Name: "[1]", Offset: 8, Type: "double"},
+			{Name: "[2]", Offset: 16, Type: "double"},
+		}},
+	}
+	b := &strings.Builder{}
+	opt := CaptureOpt{Port: "Test port", Board: 1, Format: "csv", Duration: 1500 * time.Millisecond}
+	if err := capture(opt, vars, b, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, r := range rows[1:] {
+		seen[r[2]] = true
+	}
+	if !seen["a"] || !seen["b"] || !seen["v.[0]"] || !seen["v.[2]"] {
+		t.Errorf("rows %v", rows)
+	}
+}
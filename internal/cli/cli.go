@@ -0,0 +1,136 @@
+/*
+没有浏览器的日子里，也要记得彼此
+*/
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/scutrobotlab/asuwave/internal/serial"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/elffile"
+)
+
+// 退出码
+const (
+	exitOK    = 0 // 一切顺利
+	exitLink  = 1 // 与板子的连接出了问题
+	exitUsage = 2 // 参数不对
+)
+
+var subscribeOnce sync.Once
+
+// linkFlags 是各子命令共用的参数
+type linkFlags struct {
+	port  string
+	baud  int
+	board int
+	elf   string
+}
+
+func (l *linkFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&l.port, "port", "", "serial port, or tcp://host:port, udp://host:port")
+	fs.IntVar(&l.baud, "baud", 115200, "baud rate")
+	fs.IntVar(&l.board, "board", int(variable.Board1), "board id")
+	fs.StringVar(&l.elf, "elf", "", "ELF file to resolve variable names")
+}
+
+func (l *linkFlags) check() error {
+	if l.port == "" {
+		return errors.New("-port is required")
+	}
+	if l.elf == "" {
+		return errors.New("-elf is required")
+	}
+	if l.board < 0 || l.board > 255 {
+		return fmt.Errorf("bad board: %d", l.board)
+	}
+	return nil
+}
+
+// resolveAll 读出ELF文件，找出所有变量
+func (l *linkFlags) resolveAll(names []string) ([]variable.T, error) {
+	projs, err := loadProj(l.elf)
+	if err != nil {
+		return nil, fmt.Errorf("load ELF: %w", err)
+	}
+	vars := []variable.T{}
+	for _, n := range names {
+		v, err := resolve(projs, uint8(l.board), n)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// readBatch 读出批处理文件的每一行，略去空行和#开头的注释
+func readBatch(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l := []string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l = append(l, line)
+	}
+	return l, s.Err()
+}
+
+// loadProj 读出ELF文件中的变量
+func loadProj(name string) (variable.Projs, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	e, err := elffile.Check(f)
+	if err != nil {
+		return nil, err
+	}
+	return elffile.ReadVariable(e)
+}
+
+// resolve 通过ELF中的变量名找出变量的地址和类型
+func resolve(projs variable.Projs, board uint8, name string) (variable.T, error) {
+	p, ok := projs[name]
+	if !ok {
+		return variable.T{}, errors.New("no such variable: " + name)
+	}
+	addr, err := strconv.ParseUint(p.Addr, 0, 32)
+	if err != nil {
+		return variable.T{}, fmt.Errorf("bad address of %s: %w", name, err)
+	}
+	v := variable.T{
+		Board:      board,
+		Name:       name,
+		Type:       p.Type,
+		Addr:       uint32(addr),
+		SignalGain: 1,
+	}
+	p.Apply(&v)
+	return v, nil
+}
+
+// open 打开串口，并开始定时订阅
+func open(port string, baud int, board uint8) error {
+	if err := serial.Open(port, baud, board); err != nil {
+		return err
+	}
+	subscribeOnce.Do(func() { go serial.GrSubscribe() })
+	return nil
+}
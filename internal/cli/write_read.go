@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scutrobotlab/asuwave/internal/serial"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 一次读取等待回应的时间
+const readTimeout = time.Second
+
+// result 是一个变量的读写结果
+type result struct {
+	Name  string
+	Value float64
+	Enum  string // 枚举取值的名字
+	Err   error
+}
+
+func (r result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s\terror: %v", r.Name, r.Err)
+	}
+	if r.Enum != "" {
+		return fmt.Sprintf("%s=%s(%s)\tok", r.Name, r.Enum, strconv.FormatFloat(r.Value, 'g', -1, 64))
+	}
+	return fmt.Sprintf("%s=%s\tok", r.Name, strconv.FormatFloat(r.Value, 'g', -1, 64))
+}
+
+// parsePair 拆开 name=value
+func parsePair(s string) (string, float64, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return "", 0, errors.New("want name=value: " + s)
+	}
+	name := strings.TrimSpace(s[:i])
+	v, err := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("bad value of %s: %w", name, err)
+	}
+	return name, v, nil
+}
+
+// Write 是 write 子命令：逐个写入 name=value，等待单片机确认，返回退出码
+func Write(args []string) int {
+	fs := flag.NewFlagSet("write", flag.ContinueOnError)
+	link := linkFlags{}
+	batch := ""
+	link.register(fs)
+	fs.StringVar(&batch, "f", "", "batch file, one name=value per line")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: asuwave write -port PORT -elf FILE [options] NAME=VALUE...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	pairs, err := withBatch(fs.Args(), batch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := link.check(); err != nil || len(pairs) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	names := []string{}
+	values := []float64{}
+	for _, p := range pairs {
+		n, v, err := parsePair(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		names = append(names, n)
+		values = append(values, v)
+	}
+	vars, err := link.resolveAll(names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	for i := range vars {
+		vars[i].Data = values[i]
+	}
+
+	if err := open(link.port, link.baud, uint8(link.board)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitLink
+	}
+	defer serial.CloseAll()
+	return report(os.Stdout, writeAll(vars))
+}
+
+// Read 是 read 子命令：逐个读取变量的值，返回退出码
+func Read(args []string) int {
+	fs := flag.NewFlagSet("read", flag.ContinueOnError)
+	link := linkFlags{}
+	batch := ""
+	link.register(fs)
+	fs.StringVar(&batch, "f", "", "batch file, one name per line")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: asuwave read -port PORT -elf FILE [options] NAME...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	names, err := withBatch(fs.Args(), batch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := link.check(); err != nil || len(names) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	for i, n := range names {
+		// 批处理文件可以与 write 共用，值略去不看
+		if j := strings.Index(n, "="); j > 0 {
+			names[i] = strings.TrimSpace(n[:j])
+		}
+	}
+	vars, err := link.resolveAll(names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err := open(link.port, link.baud, uint8(link.board)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitLink
+	}
+	defer serial.CloseAll()
+	return report(os.Stdout, readAll(vars))
+}
+
+// withBatch 命令行参数之后接上批处理文件的内容
+func withBatch(args []string, batch string) ([]string, error) {
+	if batch == "" {
+		return args, nil
+	}
+	l, err := readBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, l...), nil
+}
+
+// writeAll 逐个写入，每个都等到单片机确认或放弃重发
+func writeAll(vars []variable.T) []result {
+	l := []result{}
+	for _, v := range vars {
+		r := result{Name: v.Name, Value: v.Data}
+		done, err := serial.SendWriteCmd(v)
+		if err == nil {
+			err = <-done
+		}
+		r.Err = err
+		l = append(l, r)
+	}
+	return l
+}
+
+// readAll 逐个读取
+func readAll(vars []variable.T) []result {
+	l := []result{}
+	for _, v := range vars {
+		r := result{Name: v.Name}
+		if len(v.Fields) != 0 {
+			r.Err = serial.ErrSubscribeOnly
+			l = append(l, r)
+			continue
+		}
+		addr, err := serial.Deref(v, readTimeout)
+		if err != nil {
+			r.Err = err
+			l = append(l, r)
+			continue
+		}
+		ret, err := serial.ReadValue(variable.CmdT{
+			Board:  v.Board,
+			Length: v.Len(),
+			Addr:   addr,
+		}, readTimeout)
+		if err == nil {
+			r.Value = v.Value(ret.Data)
+			r.Enum, _ = v.EnumName(r.Value)
+		}
+		r.Err = err
+		l = append(l, r)
+	}
+	return l
+}
+
+// report 每个变量一行，有一个失败就以非零退出码退出
+func report(w io.Writer, l []result) int {
+	code := exitOK
+	for _, r := range l {
+		fmt.Fprintln(w, r)
+		if r.Err != nil {
+			code = exitLink
+		}
+	}
+	return code
+}
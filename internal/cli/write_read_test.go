@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/serial"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+func TestParsePair(t *testing.T) {
+	n, v, err := parsePair("chassis.pid.kp = 1.2")
+	if err != nil || n != "chassis.pid.kp" || v != 1.2 {
+		t.Errorf("parsePair: %s %g %v", n, v, err)
+	}
+	for _, s := range []string{"kp", "=1", "kp=x"} {
+		if _, _, err := parsePair(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	if err := open("Test port", 115200, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	vars := []variable.T{
+		{Board: 1, Name: "kp", Type: "float", Addr: 0x20000100, Data: 1.5},
+		{Board: 1, Name: "bad", Type: "float", Addr: 0x10000000, Data: 1},
+	}
+	l := writeAll(vars)
+	if l[0].Err != nil || l[1].Err == nil {
+		t.Fatalf("write %v", l)
+	}
+
+	l = readAll(vars[:1])
+	if l[0].Err != nil || l[0].Value != 1.5 {
+		t.Errorf("read %v", l)
+	}
+
+	b := &strings.Builder{}
+	if code := report(b, writeAll(vars)); code != exitLink {
+		t.Errorf("exit code %d", code)
+	}
+	if !strings.HasPrefix(b.String(), "kp=1.5\tok\nbad\terror: ") {
+		t.Errorf("report %q", b.String())
+	}
+}
+
+func TestWriteBits(t *testing.T) {
+	if err := open("Test port", 115200, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	// 同一个字节里的两个位域，先后改写互不干扰
+	vars := []variable.T{
+		{Board: 1, Name: "a", Type: "unsigned char", Addr: 0x20000200, BitOffset: 0, BitSize: 2, Data: 3},
+		{Board: 1, Name: "b", Type: "unsigned char", Addr: 0x20000200, BitOffset: 2, BitSize: 3, Data: 5},
+	}
+	if l := writeAll(vars); l[0].Err != nil || l[1].Err != nil {
+		t.Fatalf("write %v", l)
+	}
+	l := readAll(vars)
+	if l[0].Err != nil || l[0].Value != 3 || l[1].Err != nil || l[1].Value != 5 {
+		t.Errorf("read %v", l)
+	}
+
+	// 枚举显示取值的名字
+	e := variable.T{Board: 1, Name: "state", Type: "unsigned char", Addr: 0x20000200,
+		Enum: []variable.EnumT{{Name: "IDLE", Value: 0}, {Name: "RUN", Value: 23}}}
+	if l := readAll([]variable.T{e}); l[0].String() != "state=RUN(23)\tok" {
+		t.Errorf("enum %q", l[0])
+	}
+}
+
+func TestReadPointer(t *testing.T) {
+	if err := open("Test port", 115200, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	// 指针 0x20000300 指向 0x20000400
+	ptr := &variable.PtrT{Addr: 0x20000300, Size: 4, Offset: 8}
+	vars := []variable.T{
+		{Board: 1, Name: "p", Type: "uint32_t", Addr: 0x20000300, Data: 0x20000400},
+		{Board: 1, Name: "p->speed", Type: "float", Addr: 0x20000300, Ptr: ptr, Data: 2.5},
+	}
+	if l := writeAll(vars); l[0].Err != nil || l[1].Err != nil {
+		t.Fatalf("write %v", l)
+	}
+	l := readAll([]variable.T{vars[1], {Board: 1, Name: "speed", Type: "float", Addr: 0x20000408}})
+	if l[0].Err != nil || l[0].Value != 2.5 || l[1].Err != nil || l[1].Value != 2.5 {
+		t.Errorf("read %v", l)
+	}
+
+	// 空指针
+	null := variable.T{Board: 1, Name: "q->speed", Type: "float", Addr: 0x20000500, Ptr: &variable.PtrT{Addr: 0x20000500, Size: 4}}
+	if l := readAll([]variable.T{null}); l[0].Err != serial.ErrNullPointer {
+		t.Errorf("null %v", l)
+	}
+}
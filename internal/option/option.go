@@ -1,13 +1,14 @@
 package option
 
 import (
+	"encoding/json"
 	"flag"
-	"os"
 	"path"
 	"strconv"
 
 	"github.com/golang/glog"
 	"github.com/scutrobotlab/asuwave/internal/helper"
+	"github.com/scutrobotlab/asuwave/internal/serial"
 	"github.com/scutrobotlab/asuwave/internal/variable"
 	"github.com/scutrobotlab/asuwave/pkg/elffile"
 	"github.com/scutrobotlab/asuwave/pkg/jsonfile"
@@ -15,7 +16,7 @@ import (
 
 var (
 	logLevel     int  //log级别
-	saveFilePath bool //保存文件路径的开关状态
+	saveFilePath bool //启动时是否载回上次监视的工程文件
 )
 
 var (
@@ -28,6 +29,8 @@ type OptT struct {
 	SaveFilePath bool
 	SaveVarList  bool
 	UpdateByProj bool
+	WriteRetry   int
+	ProtocolV2   bool
 }
 
 func Get() OptT {
@@ -36,24 +39,58 @@ func Get() OptT {
 		SaveFilePath: saveFilePath,
 		SaveVarList:  variable.GetOptSaveVarList(),
 		UpdateByProj: variable.GetOptUpdateByProj(),
+		WriteRetry:   serial.GetOptWriteRetry(),
+		ProtocolV2:   serial.GetOptProtocolV2(),
 	}
 }
 
 func Load() {
-	var opt OptT
-	jsonfile.Load(optionPath, &opt) //从optionPath中加载配置选项到opt
+	opt := OptT{WriteRetry: serial.GetOptWriteRetry()} //文件中没有的选项保持默认值
+	jsonfile.Load(optionPath, &opt)                    //从optionPath中加载配置选项到opt
 	//将opt中的SaveVarList和UpdateByProj配置选项分别设置到相关变量中
 	variable.SetOptSaveVarList(opt.SaveVarList)
 	variable.SetOptUpdateByProj(opt.UpdateByProj)
+	serial.SetOptWriteRetry(opt.WriteRetry)
+	serial.SetOptProtocolV2(opt.ProtocolV2)
 
-	var watchList []string
-	jsonfile.Load(fileWatchPath, &watchList) //加载指定路径fileWatchPath的文件监视列表到字符串切片watchList中
-	for _, w := range watchList {
-		elffile.ChFileWatch <- w //将watchList中的每一个文件名发送到elffile.ChFileWatch通道中
+	saveFilePath = opt.SaveFilePath
+	jsonfile.Save(optionPath, opt)
+}
+
+// LoadWatchList 载入文件监视列表，读入其中的工程文件并监视它们
+func LoadWatchList() {
+	// 旧版只存了文件名，对所有电路板适用
+	var watchList []json.RawMessage
+	jsonfile.Load(fileWatchPath, &watchList) //加载指定路径fileWatchPath的文件监视列表
+	for _, raw := range watchList {
+		w := elffile.WatchT{Board: variable.AllBoards}
+		if err := json.Unmarshal(raw, &w.Path); err != nil {
+			if err := json.Unmarshal(raw, &w); err != nil {
+				glog.Errorln(err.Error())
+				continue
+			}
+		}
+		//先读入工程文件，再监视它的改动
+		if err := elffile.Load(w.Board, w.Path); err != nil {
+			glog.Errorln(w.Path, err.Error())
+		}
+		if err := elffile.Watch(w.Board, w.Path); err != nil {
+			glog.Errorln(w.Path, err.Error())
+		}
 	}
-	//保存当前的文件监视列表和配置选项到对应的文件中
+	//以新的格式保存回去
+	SaveWatchList()
+}
+
+// SetDir 换一个文件夹存放配置选项和文件监视列表，切换工程时用，之后再 Load
+func SetDir(dir string) {
+	optionPath = path.Join(dir, "option.json")
+	fileWatchPath = path.Join(dir, "FileWatch.json")
+}
+
+// SaveWatchList 保存当前的文件监视列表，每个工程各存一份，切换工程时不会丢
+func SaveWatchList() {
 	jsonfile.Save(fileWatchPath, elffile.GetWatchList())
-	jsonfile.Save(optionPath, opt)
 }
 
 func SetLogLevel(v int) {
@@ -75,11 +112,6 @@ func SetSaveFilePath(v bool) {
 		return
 	}
 	glog.V(1).Infof("Set SaveFilePath to %t\n", v)
-	if v {
-		jsonfile.Save(fileWatchPath, elffile.GetWatchList())
-	} else {
-		os.Remove(fileWatchPath)
-	}
 	saveFilePath = v
 	jsonfile.Save(optionPath, Get())
 }
@@ -93,3 +125,13 @@ func SetUpdateByProj(v bool) {
 	variable.SetOptUpdateByProj(v)
 	jsonfile.Save(optionPath, Get())
 }
+
+func SetWriteRetry(v int) {
+	serial.SetOptWriteRetry(v)
+	jsonfile.Save(optionPath, Get())
+}
+
+func SetProtocolV2(v bool) {
+	serial.SetOptProtocolV2(v)
+	jsonfile.Save(optionPath, Get())
+}
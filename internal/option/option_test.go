@@ -1,18 +1,24 @@
 package option_test
 
 import (
+	"fmt"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/serial"
 )
 
 func FuzzOption(f *testing.F) {
-	f.Fuzz(func(t *testing.T, logLevel int, saveFilePath bool, saveVarList bool, updateByProj bool) {
+	f.Fuzz(func(t *testing.T, logLevel int, saveFilePath bool, saveVarList bool, updateByProj bool, writeRetry int, protocolV2 bool) {
 
 		option.SetLogLevel(logLevel)
 		option.SetSaveFilePath(saveFilePath)
 		option.SetSaveVarList(saveVarList)
 		option.SetUpdateByProj(updateByProj)
+		option.SetWriteRetry(writeRetry)
+		option.SetProtocolV2(protocolV2)
 
 		got := option.Get()
 
@@ -20,9 +26,33 @@ func FuzzOption(f *testing.F) {
 		assertEQ(t, got.SaveFilePath, saveFilePath)
 		assertEQ(t, got.SaveVarList, saveVarList)
 		assertEQ(t, got.UpdateByProj, updateByProj)
+		// 重发次数超出范围时取最近的端点
+		if writeRetry < 0 {
+			writeRetry = 0
+		} else if writeRetry > serial.MaxWriteRetry {
+			writeRetry = serial.MaxWriteRetry
+		}
+		assertEQ(t, got.WriteRetry, writeRetry)
+		assertEQ(t, got.ProtocolV2, protocolV2)
 	})
 }
 
+func TestLoadWriteRetry(t *testing.T) {
+	defer serial.SetOptWriteRetry(serial.GetOptWriteRetry())
+	dir := t.TempDir()
+	option.SetDir(dir)
+	// 手改的配置文件里写了负数，不能让写命令一次也不发
+	for _, c := range []struct{ in, want int }{{-1, 0}, {3, 3}, {99, serial.MaxWriteRetry}} {
+		if err := os.WriteFile(path.Join(dir, "option.json"), []byte(fmt.Sprintf(`{"WriteRetry":%d}`, c.in)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		option.Load()
+		if r := serial.GetOptWriteRetry(); r != c.want {
+			t.Errorf("WriteRetry %d loaded as %d, want %d", c.in, r, c.want)
+		}
+	}
+}
+
 func assertEQ[V int | bool](t *testing.T, a V, b V) {
 	if a != b {
 		t.Errorf("%v != %v", a, b)
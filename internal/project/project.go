@@ -0,0 +1,179 @@
+/*
+一块板子一份固件，一份固件一个工程，各自记着自己的样子
+*/
+package project
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/helper"
+	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/elffile"
+	"github.com/scutrobotlab/asuwave/pkg/jsonfile"
+)
+
+// Default 是默认工程，沿用配置文件夹本身，旧版的配置照旧可用
+const Default = "default"
+
+// Root 是配置文件夹，其余的工程放在其下的 projects 中，各占一个文件夹
+var Root = helper.AppConfigDir()
+
+var (
+	ErrNotExist = errors.New("no such project")
+	ErrExist    = errors.New("project already exists")
+	ErrActive   = errors.New("cannot delete the active or default project")
+)
+
+// ListT 是所有工程的名字和当前的工程
+type ListT struct {
+	Active   string
+	Projects []string
+}
+
+var active = struct {
+	sync.Mutex
+	name string
+}{name: Default}
+
+// 工程名只允许作为文件夹名，不能跳出工程文件夹
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return errors.New("invalid project name")
+	}
+	return nil
+}
+
+func listDir() string {
+	return path.Join(Root, "projects")
+}
+
+func activePath() string {
+	return path.Join(Root, "project.json")
+}
+
+func dirOf(name string) string {
+	if name == Default {
+		return Root
+	}
+	return path.Join(listDir(), name)
+}
+
+func exist(name string) bool {
+	if name == Default {
+		return true
+	}
+	fi, err := os.Stat(dirOf(name))
+	return err == nil && fi.IsDir()
+}
+
+// load 从工程的文件夹载入变量列表、设置和监视的工程文件
+func load(name string) {
+	dir := dirOf(name)
+	variable.SetDir(dir)
+	option.SetDir(dir)
+	option.Load()
+	glog.Infoln("project", name, "load success.")
+}
+
+// Load 启动时载入上次的工程，它不在了就用默认工程
+func Load() {
+	active.Lock()
+	defer active.Unlock()
+	j := struct{ Active string }{Default}
+	jsonfile.Load(activePath(), &j)
+	if checkName(j.Active) != nil || !exist(j.Active) {
+		j.Active = Default
+	}
+	active.name = j.Active
+	load(active.name)
+	if option.Get().SaveFilePath {
+		option.LoadWatchList()
+	}
+}
+
+func Active() string {
+	active.Lock()
+	defer active.Unlock()
+	return active.name
+}
+
+// List 列出所有工程，默认工程在最前
+func List() (ListT, error) {
+	l := ListT{Active: Active(), Projects: []string{Default}}
+	entries, err := os.ReadDir(listDir())
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != Default {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	l.Projects = append(l.Projects, names...)
+	return l, nil
+}
+
+// Create 新建一个空的工程，切换过去之前沿用当前的设置
+func Create(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if exist(name) {
+		return ErrExist
+	}
+	return os.MkdirAll(dirOf(name), 0755)
+}
+
+// Delete 删除工程和它的全部配置，当前的工程与默认工程不能删
+func Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if !exist(name) {
+		return ErrNotExist
+	}
+	active.Lock()
+	defer active.Unlock()
+	if name == Default || name == active.name {
+		return ErrActive
+	}
+	return os.RemoveAll(dirOf(name))
+}
+
+// Switch 切换到另一个工程，原来的工程的配置都已存在它的文件夹中
+func Switch(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if !exist(name) {
+		return ErrNotExist
+	}
+	active.Lock()
+	defer active.Unlock()
+	if name == active.name {
+		return nil
+	}
+
+	// 卸下原来的工程文件，免得与新工程的混在一起；监视列表改动时已经存过了
+	if err := elffile.UnloadAll(); err != nil {
+		return err
+	}
+
+	active.name = name
+	load(name)
+	option.LoadWatchList()
+	jsonfile.Save(activePath(), struct{ Active string }{name})
+	return nil
+}
@@ -0,0 +1,102 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/elffile"
+)
+
+func TestSwitch(t *testing.T) {
+	Root = t.TempDir()
+	Load()
+	defer elffile.RemoveWathcer()
+
+	if err := Create("../evil"); err == nil {
+		t.Errorf("Create accepted a path as project name")
+	}
+	if err := Create("chassis"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create("chassis"); err != ErrExist {
+		t.Errorf("Create twice: %v", err)
+	}
+	if l, _ := List(); l.Active != Default || len(l.Projects) != 2 || l.Projects[1] != "chassis" {
+		t.Errorf("List = %v", l)
+	}
+
+	kp := variable.T{Board: variable.Board1, Name: "kp", Type: "float", Addr: 0x20000100}
+	variable.Set(variable.RD, variable.KeyOf(kp), kp)
+	option.SetWriteRetry(2)
+
+	// 新工程有自己的变量列表、设置和工程文件
+	if err := Switch("chassis"); err != nil {
+		t.Fatal(err)
+	}
+	if len(variable.GetKeys(variable.RD)) != 0 {
+		t.Errorf("variables of %s leaked", Default)
+	}
+	option.SetWriteRetry(5)
+	elffile.Watch(variable.Board2, "chassis.axf")
+	option.SaveWatchList()
+	if err := Delete("chassis"); err != ErrActive {
+		t.Errorf("Delete active: %v", err)
+	}
+
+	// 切回来，原来的都还在
+	if err := Switch(Default); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := variable.Get(variable.RD, variable.KeyOf(kp)); !ok {
+		t.Errorf("variables of %s lost", Default)
+	}
+	if r := option.Get().WriteRetry; r != 2 {
+		t.Errorf("WriteRetry = %d", r)
+	}
+	if l := elffile.GetWatchList(); len(l) != 0 {
+		t.Errorf("watch list of chassis leaked: %v", l)
+	}
+
+	if err := Switch("chassis"); err != nil {
+		t.Fatal(err)
+	}
+	if r := option.Get().WriteRetry; r != 5 {
+		t.Errorf("WriteRetry = %d", r)
+	}
+	if l := elffile.GetWatchList(); len(l) != 1 || l[0] != (elffile.WatchT{Board: variable.Board2, Path: "chassis.axf"}) {
+		t.Errorf("watch list of chassis lost: %v", l)
+	}
+
+	// 重新启动时回到上次的工程；没打开保存文件路径，不载回工程文件，但也不丢
+	elffile.RemoveWathcer()
+	active.name = Default
+	Load()
+	if Active() != "chassis" {
+		t.Errorf("Active = %s after Load", Active())
+	}
+	if l := elffile.GetWatchList(); len(l) != 0 {
+		t.Errorf("watch list restored with SaveFilePath off: %v", l)
+	}
+	Switch(Default)
+	Switch("chassis")
+	if l := elffile.GetWatchList(); len(l) != 1 {
+		t.Errorf("watch list of chassis lost after restart: %v", l)
+	}
+
+	// 打开了保存文件路径，启动时载回
+	option.SetSaveFilePath(true)
+	elffile.RemoveWathcer()
+	Load()
+	if l := elffile.GetWatchList(); len(l) != 1 {
+		t.Errorf("watch list not restored: %v", l)
+	}
+
+	Switch(Default)
+	if err := Delete("chassis"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Switch("chassis"); err != ErrNotExist {
+		t.Errorf("Switch to deleted: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 文件头
+const magic = "ASUREC1\n"
+
+// 记录类型
+const (
+	recName   byte = 'N' // 变量名定义：id(2) 长度(1) 变量名
+	recSample byte = 'S' // 采样：id(2) 板子(1) 时间戳(4) 主机时间(8) 值(8)
+)
+
+// Sample 是记录中的一个采样
+type Sample struct {
+	variable.ChartT
+	Time int64 // 主机时间，Unix 纳秒
+}
+
+// encoder 以紧凑的二进制格式写入采样，变量名只在第一次出现时写入
+type encoder struct {
+	w     *bufio.Writer
+	names map[string]uint16
+}
+
+func newEncoder(w io.Writer) (*encoder, error) {
+	e := &encoder{
+		w:     bufio.NewWriter(w),
+		names: map[string]uint16{},
+	}
+	if _, err := e.w.WriteString(magic); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *encoder) Encode(s Sample) error {
+	id, ok := e.names[s.Name]
+	if !ok {
+		if len(e.names) >= math.MaxUint16 {
+			return errors.New("too many variable names")
+		}
+		if len(s.Name) > math.MaxUint8 {
+			return errors.New("variable name too long")
+		}
+		id = uint16(len(e.names))
+		e.names[s.Name] = id
+		buf := make([]byte, 4, 4+len(s.Name))
+		buf[0] = recName
+		binary.LittleEndian.PutUint16(buf[1:3], id)
+		buf[3] = byte(len(s.Name))
+		buf = append(buf, s.Name...)
+		if _, err := e.w.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	var buf [24]byte
+	buf[0] = recSample
+	binary.LittleEndian.PutUint16(buf[1:3], id)
+	buf[3] = s.Board
+	binary.LittleEndian.PutUint32(buf[4:8], s.Tick)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(s.Time))
+	binary.LittleEndian.PutUint64(buf[16:24], math.Float64bits(s.Data))
+	_, err := e.w.Write(buf[:])
+	return err
+}
+
+func (e *encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// decoder 逐条读出采样
+type decoder struct {
+	r     *bufio.Reader
+	names map[uint16]string
+}
+
+func newDecoder(r io.Reader) (*decoder, error) {
+	d := &decoder{
+		r:     bufio.NewReader(r),
+		names: map[uint16]string{},
+	}
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(d.r, head); err != nil {
+		return nil, err
+	}
+	if string(head) != magic {
+		return nil, errors.New("not a record file")
+	}
+	return d, nil
+}
+
+// Decode 返回下一条采样，读完时返回 io.EOF
+func (d *decoder) Decode() (Sample, error) {
+	for {
+		t, err := d.r.ReadByte()
+		if err != nil {
+			return Sample{}, err
+		}
+		switch t {
+		case recName:
+			var head [3]byte
+			if _, err := io.ReadFull(d.r, head[:]); err != nil {
+				return Sample{}, io.ErrUnexpectedEOF
+			}
+			name := make([]byte, head[2])
+			if _, err := io.ReadFull(d.r, name); err != nil {
+				return Sample{}, io.ErrUnexpectedEOF
+			}
+			d.names[binary.LittleEndian.Uint16(head[0:2])] = string(name)
+		case recSample:
+			var buf [23]byte
+			if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+				return Sample{}, io.ErrUnexpectedEOF
+			}
+			id := binary.LittleEndian.Uint16(buf[0:2])
+			name, ok := d.names[id]
+			if !ok {
+				return Sample{}, errors.New("undefined variable id")
+			}
+			return Sample{
+				ChartT: variable.ChartT{
+					Board: buf[2],
+					Name:  name,
+					Tick:  binary.LittleEndian.Uint32(buf[3:7]),
+					Data:  math.Float64frombits(binary.LittleEndian.Uint64(buf[15:23])),
+				},
+				Time: int64(binary.LittleEndian.Uint64(buf[7:15])),
+			}, nil
+		default:
+			return Sample{}, errors.New("unknown record type")
+		}
+	}
+}
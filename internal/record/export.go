@@ -0,0 +1,219 @@
+package record
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 列式二进制文件头
+const columnarMagic = "ASUCOL1\n"
+
+// ExportOpt 是导出的条件
+type ExportOpt struct {
+	From  uint32   // 起始时间戳（含）
+	To    uint32   // 结束时间戳（含），为0时不限
+	Names []string // 导出的变量，为空时导出全部；写作 name 时不分电路板，写作 board:name 时只要这块板子的
+	Raw   bool     // 为true时撤销增益和偏置，还原单片机上的原始值
+}
+
+// Column 是导出的一列的元信息，取自订阅变量列表
+type Column struct {
+	Name       string
+	Board      uint8
+	Type       string
+	SignalGain float64
+	SignalBias float64
+}
+
+// table 是按时间戳对齐后的数据，缺失的值为 NaN
+type table struct {
+	Columns []Column
+	Ticks   []uint32
+	Values  [][]float64 // Values[列][行]
+}
+
+func (o ExportOpt) inWindow(tick uint32) bool {
+	return tick >= o.From && (o.To == 0 || tick <= o.To)
+}
+
+// colKey 区分一列，不同板子上的同名变量各占一列
+type colKey struct {
+	Board uint8
+	Name  string
+}
+
+// Label 是列的标题，如 1:speed
+func (c Column) Label() string {
+	return strconv.Itoa(int(c.Board)) + ":" + c.Name
+}
+
+// order 是变量在 Names 中的位置，不在其中时返回 -1
+func (o ExportOpt) order(k colKey) int {
+	for i, n := range o.Names {
+		if n == k.Name || n == strconv.Itoa(int(k.Board))+":"+k.Name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 读出记录，按时间戳对齐成表
+func load(name string, opt ExportOpt) (*table, error) {
+	index := map[colKey]int{}
+	t := &table{}
+	addColumn := func(k colKey) int {
+		i := len(t.Columns)
+		index[k] = i
+		c := Column{Name: k.Name, Board: k.Board, SignalGain: 1}
+		if v, ok := variable.GetByBoardName(variable.RD, k.Board, k.Name); ok {
+			c.Type = v.Type
+			c.SignalGain = v.SignalGain
+			c.SignalBias = v.SignalBias
+		}
+		t.Columns = append(t.Columns, c)
+		return i
+	}
+
+	rows := map[uint32]map[int]float64{}
+	err := Read(name, func(s Sample) error {
+		if !opt.inWindow(s.Tick) {
+			return nil
+		}
+		k := colKey{s.Board, s.Name}
+		i, ok := index[k]
+		if !ok {
+			if len(opt.Names) != 0 && opt.order(k) < 0 {
+				return nil
+			}
+			i = addColumn(k)
+		}
+		if _, ok := rows[s.Tick]; !ok {
+			rows[s.Tick] = map[int]float64{}
+		}
+		rows[s.Tick][i] = s.Data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 指定了变量时按指定的顺序排列，同名的按板子
+	perm := make([]int, len(t.Columns))
+	for i := range perm {
+		perm[i] = i
+	}
+	if len(opt.Names) != 0 {
+		sort.SliceStable(perm, func(i, j int) bool {
+			a, b := t.Columns[perm[i]], t.Columns[perm[j]]
+			x, y := opt.order(colKey{a.Board, a.Name}), opt.order(colKey{b.Board, b.Name})
+			if x != y {
+				return x < y
+			}
+			return a.Board < b.Board
+		})
+	}
+	columns := make([]Column, len(perm))
+	for i, p := range perm {
+		columns[i] = t.Columns[p]
+	}
+	t.Columns = columns
+
+	for tick := range rows {
+		t.Ticks = append(t.Ticks, tick)
+	}
+	sort.Slice(t.Ticks, func(i, j int) bool { return t.Ticks[i] < t.Ticks[j] })
+
+	t.Values = make([][]float64, len(t.Columns))
+	for i, c := range t.Columns {
+		t.Values[i] = make([]float64, len(t.Ticks))
+		for j, tick := range t.Ticks {
+			v, ok := rows[tick][perm[i]]
+			if !ok {
+				v = math.NaN()
+			} else if opt.Raw && c.SignalGain != 0 {
+				// 记录的是 gain*raw+bias，反过来算
+				v = (v - c.SignalBias) / c.SignalGain
+			}
+			t.Values[i][j] = v
+		}
+	}
+	return t, nil
+}
+
+// ExportCSV 以 CSV 格式导出记录，第一列为时间戳，其余每列一个变量，标题为 板子:变量名
+func ExportCSV(name string, opt ExportOpt, w io.Writer) error {
+	t, err := load(name, opt)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	head := []string{"Tick"}
+	for _, c := range t.Columns {
+		head = append(head, c.Label())
+	}
+	if err := cw.Write(head); err != nil {
+		return err
+	}
+
+	row := make([]string, len(head))
+	for j, tick := range t.Ticks {
+		row[0] = strconv.FormatUint(uint64(tick), 10)
+		for i := range t.Columns {
+			v := t.Values[i][j]
+			if math.IsNaN(v) {
+				row[i+1] = ""
+			} else {
+				row[i+1] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportColumnar 以列式二进制格式导出记录：
+// 文件头、4字节头信息长度、JSON头信息、时间戳列(uint32)、各变量列(float64，缺失为NaN)，均为小端
+func ExportColumnar(name string, opt ExportOpt, w io.Writer) error {
+	t, err := load(name, opt)
+	if err != nil {
+		return err
+	}
+
+	head, err := json.Marshal(struct {
+		Columns []Column
+		Rows    int
+	}{t.Columns, len(t.Ticks)})
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, columnarMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(head))); err != nil {
+		return err
+	}
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, t.Ticks); err != nil {
+		return err
+	}
+	for _, col := range t.Values {
+		if err := binary.Write(w, binary.LittleEndian, col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
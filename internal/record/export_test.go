@@ -0,0 +1,117 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+func writeTestRecord(t *testing.T) string {
+	Dir = t.TempDir()
+	name, err := Start("export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Write([]variable.ChartT{{Board: 1, Name: "a", Data: 1, Tick: 10}, {Board: 1, Name: "b", Data: 2, Tick: 10}})
+	time.Sleep(time.Millisecond)
+	Write([]variable.ChartT{{Board: 1, Name: "a", Data: 1.5, Tick: 11}})
+	time.Sleep(time.Millisecond)
+	Write([]variable.ChartT{{Board: 1, Name: "b", Data: -3, Tick: 12}, {Board: 1, Name: "c", Data: 4, Tick: 12}})
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestExportCSV(t *testing.T) {
+	name := writeTestRecord(t)
+	cases := []struct {
+		opt  ExportOpt
+		want string
+	}{
+		{
+			ExportOpt{},
+			"Tick,1:a,1:b,1:c\n10,1,2,\n11,1.5,,\n12,,-3,4\n",
+		},
+		{
+			ExportOpt{From: 11, To: 12, Names: []string{"b", "a"}},
+			"Tick,1:b,1:a\n11,,1.5\n12,-3,\n",
+		},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := ExportCSV(name, c.opt, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("ExportCSV(%+v)\n\thave: %q\n\twant: %q", c.opt, buf.String(), c.want)
+		}
+	}
+}
+
+func TestExportColumnar(t *testing.T) {
+	name := writeTestRecord(t)
+	var buf bytes.Buffer
+	if err := ExportColumnar(name, ExportOpt{Names: []string{"a"}}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if string(b[:len(columnarMagic)]) != columnarMagic {
+		t.Fatalf("bad magic: %q", b[:len(columnarMagic)])
+	}
+	b = b[len(columnarMagic):]
+	n := binary.LittleEndian.Uint32(b)
+	b = b[4+n:]
+
+	// 只有 a 出现的时间戳 10、11 两行
+	if len(b) != 2*4+2*8 {
+		t.Fatalf("body length %d", len(b))
+	}
+	if binary.LittleEndian.Uint32(b[0:4]) != 10 || binary.LittleEndian.Uint32(b[4:8]) != 11 {
+		t.Errorf("bad tick column: %v", b[:8])
+	}
+	if v := math.Float64frombits(binary.LittleEndian.Uint64(b[16:24])); v != 1.5 {
+		t.Errorf("a[1] == %v, want 1.5", v)
+	}
+}
+
+func TestExportBoards(t *testing.T) {
+	Dir = t.TempDir()
+	name, err := Start("boards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Write([]variable.ChartT{{Board: 2, Name: "speed", Data: 7, Tick: 1}, {Board: 1, Name: "speed", Data: 3, Tick: 1}})
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两块板子上的同名变量各用各的增益和偏置
+	v1 := variable.T{Board: 1, Name: "speed", Type: "float", Addr: 0x20000100, SignalGain: 1, SignalBias: 1}
+	v2 := variable.T{Board: 2, Name: "speed", Type: "float", Addr: 0x20000100, SignalGain: 2, SignalBias: 1}
+	variable.UseAll(variable.RD, map[variable.Key]variable.T{variable.KeyOf(v1): v1, variable.KeyOf(v2): v2})
+	defer variable.UseAll(variable.RD, map[variable.Key]variable.T{})
+
+	cases := []struct {
+		opt  ExportOpt
+		want string
+	}{
+		{ExportOpt{Raw: true}, "Tick,2:speed,1:speed\n1,3,2\n"},
+		{ExportOpt{Names: []string{"speed"}}, "Tick,1:speed,2:speed\n1,3,7\n"},
+		{ExportOpt{Names: []string{"2:speed"}}, "Tick,2:speed\n1,7\n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := ExportCSV(name, c.opt, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("ExportCSV(%+v)\n\thave: %q\n\twant: %q", c.opt, buf.String(), c.want)
+		}
+	}
+}
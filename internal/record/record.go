@@ -0,0 +1,210 @@
+/*
+把每一刻都记下来，以后慢慢回味
+*/
+package record
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/helper"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 记录文件的扩展名
+const ext = ".rec"
+
+// Dir 是记录文件所在的文件夹
+var Dir = path.Join(helper.AppConfigDir(), "record")
+
+// Info 是一份记录的概要
+type Info struct {
+	Name      string
+	Size      int64
+	ModTime   time.Time
+	Recording bool
+}
+
+var recorder struct {
+	sync.Mutex
+	name      string
+	file      *os.File
+	enc       *encoder
+	lastFlush time.Time
+}
+
+// 记录名只允许作为文件名，不能跳出记录文件夹
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return errors.New("invalid record name")
+	}
+	return nil
+}
+
+func filePath(name string) string {
+	return path.Join(Dir, name+ext)
+}
+
+// Start 开始一份新的记录，name 为空时以当前时间命名
+func Start(name string) (string, error) {
+	if name == "" {
+		name = time.Now().Format("20060102-150405")
+	}
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	if recorder.file != nil {
+		return "", errors.New("already recording: " + recorder.name)
+	}
+
+	if err := os.MkdirAll(Dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(filePath(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	enc, err := newEncoder(f)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	recorder.name = name
+	recorder.file = f
+	recorder.enc = enc
+	recorder.lastFlush = time.Now()
+	glog.Infoln("Start recording:", f.Name())
+	return name, nil
+}
+
+// Stop 结束当前的记录
+func Stop() error {
+	recorder.Lock()
+	defer recorder.Unlock()
+	if recorder.file == nil {
+		return errors.New("not recording")
+	}
+
+	err := recorder.enc.Flush()
+	if cerr := recorder.file.Close(); err == nil {
+		err = cerr
+	}
+	glog.Infoln("Stop recording:", recorder.name)
+	recorder.name = ""
+	recorder.file = nil
+	recorder.enc = nil
+	return err
+}
+
+// Current 返回正在记录的名字，未在记录时为空
+func Current() string {
+	recorder.Lock()
+	defer recorder.Unlock()
+	return recorder.name
+}
+
+// Write 把一组图表数据追加到当前记录中，未在记录时什么也不做
+func Write(chart []variable.ChartT) {
+	recorder.Lock()
+	defer recorder.Unlock()
+	if recorder.enc == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, c := range chart {
+		if err := recorder.enc.Encode(Sample{ChartT: c, Time: now.UnixNano()}); err != nil {
+			glog.Errorln("record write:", err)
+			return
+		}
+	}
+
+	// 不必每次都落盘，但也别让数据在缓存里待太久
+	if now.Sub(recorder.lastFlush) > time.Second {
+		if err := recorder.enc.Flush(); err != nil {
+			glog.Errorln("record flush:", err)
+		}
+		recorder.lastFlush = now
+	}
+}
+
+// List 列出所有的记录
+func List() ([]Info, error) {
+	list := []Info{}
+	entries, err := os.ReadDir(Dir)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return list, err
+	}
+
+	cur := Current()
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ext)
+		list = append(list, Info{
+			Name:      name,
+			Size:      fi.Size(),
+			ModTime:   fi.ModTime(),
+			Recording: name == cur,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ModTime.Before(list[j].ModTime) })
+	return list, nil
+}
+
+// Read 按顺序读出记录中的每个采样，f 返回错误时停止
+func Read(name string, f func(Sample) error) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	file, err := os.Open(filePath(name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return readFrom(file, name, f)
+}
+
+// readFrom 从打开的记录文件中读出每个采样
+func readFrom(file io.Reader, name string, f func(Sample) error) error {
+	dec, err := newDecoder(file)
+	if err != nil {
+		return err
+	}
+	for {
+		s, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			// 录制中途退出，残缺的最后一条就不要了
+			glog.Warningln("record truncated:", name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(s); err != nil {
+			return err
+		}
+	}
+}
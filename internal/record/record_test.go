@@ -0,0 +1,99 @@
+package record
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	Dir = t.TempDir()
+
+	batches := [][]variable.ChartT{
+		{{Board: 1, Name: "a", Data: -8.25, Tick: 1}, {Board: 1, Name: "b", Data: 3, Tick: 1}},
+		{{Board: 2, Name: "a", Data: 1e10, Tick: 2}},
+	}
+
+	if _, err := Start("../evil"); err == nil {
+		t.Errorf("Start accepted a path as record name")
+	}
+	name, err := Start("run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Start("again"); err == nil {
+		t.Errorf("Start twice should fail")
+	}
+	for _, b := range batches {
+		Write(b)
+		time.Sleep(time.Millisecond)
+	}
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+	Write(batches[0]) // 停止后不再记录
+
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != name || list[0].Recording {
+		t.Fatalf("List() == %+v", list)
+	}
+
+	got := []variable.ChartT{}
+	err = Read(name, func(s Sample) error {
+		if s.Time == 0 {
+			t.Errorf("sample without host time: %+v", s)
+		}
+		got = append(got, s.ChartT)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]variable.ChartT{}, batches[0]...), batches[1]...)
+	if len(got) != len(want) {
+		t.Fatalf("Read got %d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sample %d: have %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	out := make(chan []variable.ChartT, 10)
+	if err := Replay(name, 1000, func(c []variable.ChartT) { out <- c }); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range batches {
+		select {
+		case c := <-out:
+			if len(c) != len(b) {
+				t.Errorf("replay batch %d: have %v, want %v", i, c, b)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("replay batch %d timeout", i)
+		}
+	}
+}
+
+func TestEncodeTooManyNames(t *testing.T) {
+	e, err := newEncoder(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 编号是 uint16，名字再多就会绕回来与第一个重名
+	for i := 0; i < math.MaxUint16; i++ {
+		if err := e.Encode(Sample{ChartT: variable.ChartT{Board: 1, Name: strconv.Itoa(i)}}); err != nil {
+			t.Fatalf("name %d: %v", i, err)
+		}
+	}
+	if err := e.Encode(Sample{ChartT: variable.ChartT{Board: 1, Name: "one more"}}); err == nil {
+		t.Errorf("Encode accepted name %d", math.MaxUint16+1)
+	}
+}
@@ -0,0 +1,105 @@
+package record
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+var errReplayStopped = errors.New("replay stopped")
+
+var replayer struct {
+	sync.Mutex
+	name string
+	stop chan bool
+}
+
+// Replay 在后台按录制时的节奏重放记录，speed 为倍速，同一时刻录下的采样一起交给 out
+func Replay(name string, speed float64, out func([]variable.ChartT)) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+
+	replayer.Lock()
+	defer replayer.Unlock()
+	if replayer.stop != nil {
+		return errors.New("already replaying: " + replayer.name)
+	}
+	// 先打开文件，之后换了记录文件夹也不要紧
+	file, err := os.Open(filePath(name))
+	if err != nil {
+		return err
+	}
+	stop := make(chan bool)
+	replayer.name = name
+	replayer.stop = stop
+
+	go func() {
+		defer file.Close()
+		err := replay(file, name, speed, out, stop)
+		if err != nil && err != errReplayStopped {
+			glog.Errorln("replay:", err)
+		}
+		glog.Infoln("Replay done:", name)
+
+		replayer.Lock()
+		defer replayer.Unlock()
+		if replayer.stop == stop {
+			replayer.name = ""
+			replayer.stop = nil
+		}
+	}()
+	glog.Infof("Start replay: %s x%g\n", name, speed)
+	return nil
+}
+
+func replay(file io.Reader, name string, speed float64, out func([]variable.ChartT), stop chan bool) error {
+	var chart []variable.ChartT
+	var last int64
+	err := readFrom(file, name, func(s Sample) error {
+		if len(chart) > 0 && s.Time != last {
+			out(chart)
+			chart = nil
+			select {
+			case <-time.After(time.Duration(float64(s.Time-last) / speed)):
+			case <-stop:
+				return errReplayStopped
+			}
+		}
+		last = s.Time
+		chart = append(chart, s.ChartT)
+		return nil
+	})
+	if err == nil && len(chart) > 0 {
+		out(chart)
+	}
+	return err
+}
+
+// StopReplay 停止正在进行的重放
+func StopReplay() error {
+	replayer.Lock()
+	defer replayer.Unlock()
+	if replayer.stop == nil {
+		return errors.New("not replaying")
+	}
+	close(replayer.stop)
+	replayer.name = ""
+	replayer.stop = nil
+	return nil
+}
+
+// Replaying 返回正在重放的记录名，未在重放时为空
+func Replaying() string {
+	replayer.Lock()
+	defer replayer.Unlock()
+	return replayer.name
+}
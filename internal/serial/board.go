@@ -0,0 +1,82 @@
+package serial
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 多久没有收到数据包就认为电路板已离线
+const boardAliveTimeout = time.Second
+
+// BoardStat 是一块电路板的通信状况
+type BoardStat struct {
+	Board    uint8
+	Alive    bool      // 最近是否收到过数据包
+	LastTick uint32    // 最后一个数据包中的时间戳
+	LastSeen time.Time // 最后一次收到数据包的时间
+	Packets  uint64    // 收到的数据包数
+	Rate     float64   // 每秒收到的数据包数
+	Errors   uint64    // 收到的错误回应数
+
+	windowStart time.Time
+	windowCount uint64
+}
+
+var boards = struct {
+	sync.Mutex
+	m map[uint8]*BoardStat
+}{
+	m: map[uint8]*BoardStat{},
+}
+
+// boardSeen 根据收到的数据包更新电路板的状况
+func boardSeen(v variable.CmdT) {
+	boards.Lock()
+	defer boards.Unlock()
+	t := time.Now()
+	b, ok := boards.m[v.Board]
+	if !ok {
+		b = &BoardStat{Board: v.Board, windowStart: t}
+		boards.m[v.Board] = b
+	}
+	b.LastTick = v.Tick
+	b.LastSeen = t
+	b.Packets++
+	b.windowCount++
+	if d := t.Sub(b.windowStart); d >= time.Second {
+		b.Rate = float64(b.windowCount) / d.Seconds()
+		b.windowStart = t
+		b.windowCount = 0
+	}
+	if variable.IsError(v.Act) {
+		b.Errors++
+	}
+}
+
+// resetBoards 串口重新打开后重新统计
+func resetBoards() {
+	boards.Lock()
+	defer boards.Unlock()
+	boards.m = map[uint8]*BoardStat{}
+}
+
+// GetBoards 返回所有收到过数据包的电路板的状况
+func GetBoards() []BoardStat {
+	boards.Lock()
+	defer boards.Unlock()
+	t := time.Now()
+	l := []BoardStat{}
+	for _, b := range boards.m {
+		s := *b
+		s.Alive = t.Sub(s.LastSeen) < boardAliveTimeout
+		if !s.Alive {
+			s.Rate = 0
+		}
+		l = append(l, s)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Board < l[j].Board })
+	return l
+}
@@ -0,0 +1,211 @@
+package serial
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
+)
+
+// 握手时等待回应的时间，超时则沿用 v1
+const helloTimeout = 300 * time.Millisecond
+
+// 是否在打开串口时协商使用 v2 协议
+var optProtocolV2 = false
+
+// Only call by option.
+func SetOptProtocolV2(v bool) {
+	if optProtocolV2 == v {
+		glog.V(1).Infof("ProtocolV2 has set to %t, skip\n", v)
+		return
+	}
+	glog.V(1).Infof("Set ProtocolV2 to %t\n", v)
+	optProtocolV2 = v
+}
+
+// Only call by option.
+func GetOptProtocolV2() bool {
+	return optProtocolV2
+}
+
+// LinkStat 是一个串口上的协议版本和收帧计数
+type LinkStat struct {
+	Version   uint8
+	Batch     bool    // 单片机是否发送批量帧
+	V2Boards  []uint8 // 答应了使用 v2 的板子，其余的板子仍用 v1
+	Frames    uint64  // 收到的完好的帧
+	CRCErrors uint64  // CRC 校验失败的帧
+	SeqGaps   uint64  // 按序号推算丢失的帧
+	BadFrames uint64  // 其他解不开的帧
+}
+
+// link 一个串口上可能挂着几块板子，各自握手，各自给帧编号
+type link struct {
+	sync.Mutex
+	LinkStat
+	caps  map[uint8]uint8 // 答应了 v2 的板子及其能力
+	txSeq map[uint8]uint8
+	rxSeq map[uint8]uint8 // 各板子上一帧的序号
+	hello bool            // 正在握手
+}
+
+func (l *link) stat() LinkStat {
+	l.Lock()
+	defer l.Unlock()
+	s := l.LinkStat
+	s.Version = protocol.V1
+	s.V2Boards = []uint8{}
+	for b, c := range l.caps {
+		s.Version = protocol.V2
+		s.Batch = s.Batch || c&protocol.CapBatch != 0
+		s.V2Boards = append(s.V2Boards, b)
+	}
+	sort.Slice(s.V2Boards, func(i, j int) bool { return s.V2Boards[i] < s.V2Boards[j] })
+	return s
+}
+
+// shake 握手开始，所有板子在结果出来前先用 v1，序号从头算起
+func (l *link) shake() {
+	l.Lock()
+	defer l.Unlock()
+	l.caps = map[uint8]uint8{}
+	l.txSeq = map[uint8]uint8{}
+	l.rxSeq = map[uint8]uint8{}
+	l.hello = true
+}
+
+// accept 板子答应了 v2，此后发给它的请求换用 v2
+func (l *link) accept(board uint8, caps uint8) {
+	l.Lock()
+	defer l.Unlock()
+	if l.caps == nil {
+		l.caps = map[uint8]uint8{}
+	}
+	l.caps[board] = caps
+	delete(l.txSeq, board)
+	delete(l.rxSeq, board)
+}
+
+// shaken 握手结束
+func (l *link) shaken() {
+	l.Lock()
+	defer l.Unlock()
+	l.hello = false
+}
+
+// wide 板子能否传回超过 DataLen 的值，握手还没结束时 pending 为 true
+func (l *link) wide(board uint8) (ok, pending bool) {
+	l.Lock()
+	defer l.Unlock()
+	return l.caps[board]&protocol.CapBatch != 0, l.hello
+}
+
+// frame 按板子协商好的版本给 v1 请求换上合适的外衣
+func (l *link) frame(data []byte) []byte {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.caps) == 0 {
+		return data
+	}
+	r, err := protocol.DecodeRequest(data)
+	if err != nil {
+		glog.Errorln("frame:", err)
+		return data
+	}
+	if _, ok := l.caps[r.Board]; !ok {
+		return data
+	}
+	if l.txSeq == nil {
+		l.txSeq = map[uint8]uint8{}
+	}
+	b := r.EncodeV2(l.txSeq[r.Board])
+	l.txSeq[r.Board]++
+	return b
+}
+
+// received 清点收到的帧，v2 的帧按序号推算丢了多少，每块单片机各自编号
+func (l *link) received(frames []protocol.Frame, errs []error) {
+	l.Lock()
+	defer l.Unlock()
+	for _, err := range errs {
+		glog.V(1).Infoln("Invalid frame:", err)
+		if errors.Is(err, protocol.ErrCRC) {
+			l.CRCErrors++
+		} else {
+			l.BadFrames++
+		}
+	}
+	if l.rxSeq == nil {
+		l.rxSeq = map[uint8]uint8{}
+	}
+	for _, f := range frames {
+		l.Frames++
+		if f.Version != protocol.V2 {
+			continue
+		}
+		if last, ok := l.rxSeq[f.Board]; ok {
+			if gap := f.Seq - last - 1; gap != 0 {
+				glog.V(1).Infof("Board %d sequence gap: %d frames lost\n", f.Board, gap)
+				l.SeqGaps += uint64(gap)
+			}
+		}
+		l.rxSeq[f.Board] = f.Seq
+	}
+}
+
+// negotiate 与串口上的每块单片机协商协议版本，不支持 v2 的单片机会回应错误或是沉默，
+// 只有答应了的板子改用 v2。调用前先 shake
+func (p *Info) negotiate() {
+	defer p.link.shaken()
+	boards := p.Boards
+	if len(boards) == 0 {
+		boards = []uint8{variable.Board1}
+	}
+
+	for _, b := range boards {
+		k := pendKey{Act: protocol.HelloReturn, Board: b}
+		ch := expect(k)
+		r := protocol.Request{Board: b, Act: protocol.Hello}
+		r.Data[0] = protocol.V2
+		r.Data[1] = protocol.CapBatch
+		sent(protocol.Hello, variable.CmdT{Board: b})
+		select {
+		case p.chTx <- r.Encode():
+		case <-p.chEd:
+			forget(k, ch)
+			return
+		}
+
+		select {
+		case rep := <-ch:
+			if rep.err == nil && rep.v.Data[0] == protocol.V2 {
+				p.link.accept(b, rep.v.Data[1])
+				glog.Infof("%s board %d use protocol v2, capabilities 0x%02x\n", p.name(), b, rep.v.Data[1])
+			} else {
+				glog.Infoln(p.name(), "board", b, "refused protocol v2:", rep.err)
+			}
+		case <-time.After(helloTimeout):
+			glog.Infoln(p.name(), "board", b, "did not answer hello, use protocol v1")
+		case <-p.chEd:
+			forget(k, ch)
+			return
+		}
+		forget(k, ch)
+	}
+}
+
+// wideReady 板子所在的串口能否传回超过 DataLen 的值
+func wideReady(board uint8) (ok, pending bool) {
+	l := portsFor(board)
+	ok = len(l) != 0
+	for _, p := range l {
+		o, w := p.link.wide(board)
+		ok = ok && o
+		pending = pending || w
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package serial
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
+)
+
+var ErrTimeout = errors.New("wait for reply timeout")
+
+// ErrSubscribeOnly 宽的值和整块的结构体只能订阅，不能读写
+var ErrSubscribeOnly = errors.New("struct snapshot or value longer than 8 bytes can only be subscribed")
+
+// ErrNoBatch 宽的值只能由批量帧传回，单片机却不支持
+var ErrNoBatch = errors.New("batch frames unsupported, cannot subscribe value longer than 8 bytes")
+
+// pendKey 标识一个等待中的回应
+type pendKey struct {
+	Act   variable.ActMode // 期待的回应代号
+	Board uint8
+	Addr  uint32
+}
+
+// reply 是一个回应，或是单片机返回的错误
+type reply struct {
+	v   variable.CmdT
+	err error
+}
+
+// 等待回应的请求，同一个 pendKey 可以有多个等待者
+var pending = struct {
+	sync.Mutex
+	m map[pendKey][]chan reply
+}{
+	m: map[pendKey][]chan reply{},
+}
+
+// expect 登记一个期待的回应
+func expect(k pendKey) chan reply {
+	ch := make(chan reply, 1)
+	pending.Lock()
+	defer pending.Unlock()
+	pending.m[k] = append(pending.m[k], ch)
+	return ch
+}
+
+// forget 取消登记
+func forget(k pendKey, ch chan reply) {
+	pending.Lock()
+	defer pending.Unlock()
+	l := pending.m[k]
+	for i, c := range l {
+		if c == ch {
+			l = append(l[:i], l[i+1:]...)
+			break
+		}
+	}
+	if len(l) == 0 {
+		delete(pending.m, k)
+	} else {
+		pending.m[k] = l
+	}
+}
+
+// resolve 把回应交给所有等待者，没有人在等时返回 false
+func resolve(k pendKey, v variable.CmdT) bool {
+	pending.Lock()
+	defer pending.Unlock()
+	l, ok := pending.m[k]
+	if !ok {
+		return false
+	}
+	delete(pending.m, k)
+	for _, ch := range l {
+		ch <- reply{v: v}
+	}
+	return true
+}
+
+// reject 把错误交给等待同一板子同一地址的所有人
+func reject(board uint8, addr uint32, err error) bool {
+	pending.Lock()
+	defer pending.Unlock()
+	found := false
+	for k, l := range pending.m {
+		if k.Board != board || k.Addr != addr {
+			continue
+		}
+		delete(pending.m, k)
+		for _, ch := range l {
+			ch <- reply{err: err}
+		}
+		found = true
+	}
+	return found
+}
+
+// request 发出请求并等待对应的回应
+func request(act variable.ActMode, data []byte, k pendKey, timeout time.Duration) (variable.CmdT, error) {
+	ch := expect(k)
+	defer forget(k, ch)
+
+	glog.Infoln("Send request", act, k)
+	sent(act, variable.CmdT{Board: k.Board, Addr: k.Addr})
+	if err := send(k.Board, data); err != nil {
+		return variable.CmdT{}, err
+	}
+
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-time.After(timeout):
+		return variable.CmdT{}, ErrTimeout
+	}
+}
+
+// ReadValue 读取一次位于给定地址的值，不必订阅
+func ReadValue(v variable.CmdT, timeout time.Duration) (variable.CmdT, error) {
+	if v.Length > protocol.DataLen {
+		return variable.CmdT{}, ErrSubscribeOnly
+	}
+	k := pendKey{Act: variable.ReadReturn, Board: v.Board, Addr: v.Addr}
+	return request(variable.Read, variable.MakeCmd(variable.Read, v), k, timeout)
+}
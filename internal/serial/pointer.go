@@ -0,0 +1,64 @@
+package serial
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// ErrNullPointer 指针还没有指向任何地方
+var ErrNullPointer = errors.New("null pointer")
+
+// 读指针时等待回应的时间
+const derefTimeout = 200 * time.Millisecond
+
+// Deref 读出指针，算出它所指的变量的地址
+func Deref(v variable.T, timeout time.Duration) (uint32, error) {
+	return deref(v, timeout, map[variable.Key]reply{})
+}
+
+// deref 同一个指针只读一次，读过的记在 read 中
+func deref(v variable.T, timeout time.Duration, read map[variable.Key]reply) (uint32, error) {
+	if v.Ptr == nil {
+		return v.Addr, nil
+	}
+	k := variable.Key{Board: v.Board, Addr: v.Ptr.Addr}
+	r, ok := read[k]
+	if !ok {
+		r.v, r.err = ReadValue(variable.CmdT{Board: v.Board, Length: v.Ptr.Size, Addr: v.Ptr.Addr}, timeout)
+		read[k] = r
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	addr, ok := v.Ptr.Target(r.v.Data)
+	if !ok {
+		return 0, ErrNullPointer
+	}
+	return addr, nil
+}
+
+// refreshPointers 重新读出所有指针，指向别处的变量跟着搬过去
+func refreshPointers() {
+	read := map[variable.Key]reply{}
+	for _, o := range []variable.Mod{variable.RD, variable.WR} {
+		for _, v := range variable.GetPointers(o) {
+			addr, err := deref(v, derefTimeout, read)
+			if err != nil {
+				// 读不到或是空指针，先留在原处
+				glog.V(3).Infoln("Deref", v.Name, err)
+				continue
+			}
+			if addr == v.Addr {
+				continue
+			}
+			if !variable.Move(o, variable.KeyOf(v), addr) {
+				glog.Warningf("%s moved to %08X, but address already used\n", v.Name, addr)
+				continue
+			}
+			glog.Infof("%s moved to %08X\n", v.Name, addr)
+		}
+	}
+}
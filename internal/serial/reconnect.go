@@ -0,0 +1,185 @@
+package serial
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// PortState 是一个已打开串口所处的状态
+type PortState int
+
+const (
+	_                PortState = iota
+	PortOpen                   // 一切如常
+	PortReconnecting           // 设备失联，正在寻找
+)
+
+var portStateText = map[PortState]string{
+	PortOpen:         "open",
+	PortReconnecting: "reconnecting",
+}
+
+func (s PortState) String() string {
+	return portStateText[s]
+}
+
+func (s PortState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// 失联后每隔多久找一次设备
+const reconnectInterval = 500 * time.Millisecond
+
+// usbDetails 找出串口对应的USB设备，不是USB设备时返回 nil
+func usbDetails(name string) *enumerator.PortDetails {
+	l, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		glog.V(1).Infoln("GetDetailedPortsList error:", err)
+		return nil
+	}
+	for _, d := range l {
+		if d.Name == name && d.IsUSB {
+			glog.Infof("%s is USB device %s:%s %s\n", name, d.VID, d.PID, d.SerialNumber)
+			return d
+		}
+	}
+	return nil
+}
+
+// sameDevice 判断是不是打开时的那个USB设备，重新插上后串口名可能已经变了
+func sameDevice(usb *enumerator.PortDetails, d *enumerator.PortDetails) bool {
+	return d.IsUSB &&
+		strings.EqualFold(d.VID, usb.VID) &&
+		strings.EqualFold(d.PID, usb.PID) &&
+		d.SerialNumber == usb.SerialNumber
+}
+
+// findDevice 在现有的串口中找回失联的设备，网络地址不会变
+func (p *Info) findDevice(name string) (string, bool) {
+	if isNetwork(name) {
+		return name, true
+	}
+	if p.usb == nil {
+		// 认不出是哪个设备，只好按名字找
+		ports, err := serial.GetPortsList()
+		if err != nil {
+			return "", false
+		}
+		for _, n := range ports {
+			if n == name {
+				return n, true
+			}
+		}
+		return "", false
+	}
+	l, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return "", false
+	}
+	for _, d := range l {
+		if sameDevice(p.usb, d) {
+			return d.Name, true
+		}
+	}
+	return "", false
+}
+
+// reconnect 设备失联或网络断开后不断寻找，找到后以原来的设置重新打开，并重新订阅。
+// 串口被关闭时返回 false
+func (p *Info) reconnect() bool {
+	p.mu.Lock()
+	p.State = PortReconnecting
+	p.Port.Close()
+	old := p.Name
+	p.mu.Unlock()
+	glog.Warningln(old, "lost, reconnecting...")
+
+	for {
+		select {
+		case <-p.chEd:
+			return false
+		case <-time.After(reconnectInterval):
+		}
+
+		name, ok := p.findDevice(old)
+		if !ok {
+			continue
+		}
+		port, err := openTransport(name, &p.Mode)
+		if err != nil {
+			glog.V(1).Infoln("Reopen error:", err)
+			continue
+		}
+
+		p.mu.Lock()
+		select {
+		case <-p.chEd:
+			// 找回来时已经被关掉了
+			p.mu.Unlock()
+			port.Close()
+			return false
+		default:
+		}
+		p.Port = port
+		p.Name = name
+		p.State = PortOpen
+		p.mu.Unlock()
+
+		if name != old {
+			rename(old, name)
+		}
+		glog.Infoln(name, "Reconnected.")
+		if GetOptProtocolV2() {
+			// 单片机可能已经重启，回到了 v1
+			p.link.shake()
+			go p.negotiate()
+		}
+		resubscribeOn(name)
+		return true
+	}
+}
+
+// rename 设备重新插上后换了名字，串口表和路由表跟着改
+func rename(old, name string) {
+	ports.Lock()
+	if p, ok := ports.m[old]; ok {
+		delete(ports.m, old)
+		ports.m[name] = p
+	}
+	ports.Unlock()
+
+	routes.Lock()
+	for b, n := range routes.m {
+		if n == old {
+			routes.m[b] = name
+		}
+	}
+	routes.Unlock()
+}
+
+// resubscribeOn 单片机可能已经重启，忘掉这个串口上的板子的订阅，立即重新订阅
+func resubscribeOn(name string) {
+	routes.RLock()
+	boards := []uint8{}
+	for b, n := range routes.m {
+		if n == name {
+			boards = append(boards, b)
+		}
+	}
+	routes.RUnlock()
+
+	if len(boards) == 0 {
+		// 不知道有哪些板子，只好全部重来
+		variable.ResetSubs()
+	}
+	for _, b := range boards {
+		variable.ResetSubsOf(b)
+	}
+	resubscribe()
+}
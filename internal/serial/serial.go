@@ -3,38 +3,70 @@ package serial
 import (
 	"encoding/json"
 	"errors"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
 
 	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/record"
 	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
 )
 
 type Info struct {
-	Name string
-	Mode serial.Mode
-	Port serial.Port
+	Name   string
+	Mode   serial.Mode
+	Port   Transport
+	State  PortState
+	Boards []uint8 // 手动指定连接在此串口上的板子
+
+	usb  *enumerator.PortDetails // 打开时认得的USB设备，断线后凭它找回
+	link link                    // 协议版本与收帧计数
+	mu   sync.Mutex              // 守着 Port 和 State
+	chEd chan bool               // 沉默不语
+	chRx chan []byte             // 来信收讫
+	chTx chan []byte             // 去信已至
+	once sync.Once               // 只道别一次
 }
 
-var SerialCur = Info{
-	Name: "",
-	Mode: serial.Mode{
-		BaudRate: 115200,
-		Parity:   serial.NoParity,
-		DataBits: 8,
-		StopBits: serial.OneStopBit,
-	},
-	Port: nil,
+// PortStat 是一个已打开串口的概况
+type PortStat struct {
+	Serial string
+	Baud   int
+	State  PortState
+	Boards []uint8 // 连接在此串口上的板子，含手动指定的和收到过数据包的
+	Link   LinkStat
 }
 
-var Chch = make(chan string) // 新图表Json
+// DefaultMode 是打开串口时的默认设置
+var DefaultMode = serial.Mode{
+	BaudRate: 115200,
+	Parity:   serial.NoParity,
+	DataBits: 8,
+	StopBits: serial.OneStopBit,
+}
+
+// 所有已打开的串口
+var ports = struct {
+	sync.RWMutex
+	m map[string]*Info
+}{
+	m: map[string]*Info{},
+}
 
-var chOp = make(chan bool)        // 敞开心扉
-var chEd = make(chan bool)        // 沉默不语
-var chRx = make(chan []byte, 100) // 来信收讫
-var chTx = make(chan []byte, 10)  // 去信已至
+// 每块板子连接在哪个串口上
+var routes = struct {
+	sync.RWMutex
+	m map[uint8]string
+}{
+	m: map[uint8]string{},
+}
+
+var Chch = make(chan string) // 新图表Json
 
 const testPortName = "Test port"
 
@@ -58,48 +90,210 @@ func Find() []string {
 	return ports
 }
 
-// Open serial port
-func Open(name string, baud int) error {
-	SerialCur.Name = name
-	SerialCur.Mode.BaudRate = baud
+// Open serial port，可以同时打开多个串口，boards 指定连接在此串口上的板子。
+// name 也可以是网络地址，如 tcp://192.168.4.1:5000、udp://192.168.4.1:5000
+func Open(name string, baud int, boards ...uint8) error {
+	ports.Lock()
+	defer ports.Unlock()
+	if _, ok := ports.m[name]; ok {
+		return errors.New("serial port had opened: " + name)
+	}
 
-	if name == testPortName {
-		SerialCur.Port = newTestPort()
-		chOp <- true
-		return nil
+	p := &Info{
+		Name:   name,
+		Mode:   DefaultMode,
+		Boards: boards,
+		chEd:   make(chan bool),
+		chRx:   make(chan []byte, 100),
+		chTx:   make(chan []byte, 10),
 	}
+	p.Mode.BaudRate = baud
 
 	var err error
-	SerialCur.Port, err = serial.Open(SerialCur.Name, &SerialCur.Mode)
+	p.Port, err = openTransport(p.Name, &p.Mode)
 	if err != nil {
-		SerialCur.Name = ""
 		return err
 	}
-	glog.Infoln(SerialCur.Name, "Opened.")
-	chOp <- true
+	p.State = PortOpen
+	if name != testPortName && !isNetwork(name) {
+		p.usb = usbDetails(name)
+	}
+	glog.Infoln(p.Name, "Opened.")
+
+	// 第一个串口打开时，一切从头来过
+	if len(ports.m) == 0 {
+		resetRejected()
+		resetBoards()
+		variable.ResetSubs()
+	}
+	routes.Lock()
+	for _, b := range boards {
+		routes.m[b] = name
+	}
+	routes.Unlock()
+
+	ports.m[name] = p
+	go p.grReceive()
+	go p.grTransmit()
+	go p.grRxPrase()
+	if GetOptProtocolV2() {
+		p.link.shake()
+		go p.negotiate()
+	}
 	return nil
 }
 
 // Close serial port
-func Close() error {
-	if SerialCur.Name == "" {
-		return errors.New("serial port had closed")
+func Close(name string) error {
+	ports.Lock()
+	p, ok := ports.m[name]
+	delete(ports.m, name)
+	ports.Unlock()
+	if !ok {
+		return errors.New("serial port had closed: " + name)
 	}
 
-	err := SerialCur.Port.Close()
-	if err != nil {
-		return err
+	p.mu.Lock()
+	p.once.Do(func() { close(p.chEd) })
+	var err error
+	if p.State != PortReconnecting { // 重连中的串口已经关过了
+		err = p.Port.Close()
+	}
+	p.mu.Unlock()
+	glog.Infoln(name, "Closed.")
+
+	// 关不掉也已经移除了，路由与订阅照样清理
+	routes.Lock()
+	for b, n := range routes.m {
+		if n == name {
+			delete(routes.m, b)
+		}
+	}
+	routes.Unlock()
+	if !IsOpen() {
+		variable.ResetSubs()
+	}
+	return err
+}
+
+// CloseAll 关闭所有串口
+func CloseAll() error {
+	var err error
+	for _, s := range List() {
+		if e := Close(s.Serial); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// IsOpen 是否有已打开的串口
+func IsOpen() bool {
+	ports.RLock()
+	defer ports.RUnlock()
+	return len(ports.m) != 0
+}
+
+// List 列出所有已打开的串口
+func List() []PortStat {
+	ports.RLock()
+	defer ports.RUnlock()
+	routes.RLock()
+	defer routes.RUnlock()
+
+	l := []PortStat{}
+	for _, p := range ports.m {
+		p.mu.Lock()
+		s := PortStat{
+			Serial: p.Name,
+			Baud:   p.Mode.BaudRate,
+			State:  p.State,
+			Link:   p.link.stat(),
+			Boards: []uint8{},
+		}
+		p.mu.Unlock()
+		for b, n := range routes.m {
+			if n == s.Serial {
+				s.Boards = append(s.Boards, b)
+			}
+		}
+		sort.Slice(s.Boards, func(i, j int) bool { return s.Boards[i] < s.Boards[j] })
+		l = append(l, s)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Serial < l[j].Serial })
+	return l
+}
+
+// portsFor 找出板子所在的串口，不知道时就发给所有串口
+func portsFor(board uint8) []*Info {
+	ports.RLock()
+	defer ports.RUnlock()
+	routes.RLock()
+	defer routes.RUnlock()
+
+	if n, ok := routes.m[board]; ok {
+		if p, ok := ports.m[n]; ok {
+			return []*Info{p}
+		}
+	}
+	l := []*Info{}
+	for _, p := range ports.m {
+		l = append(l, p)
+	}
+	return l
+}
+
+// send 把数据发往板子所在的串口
+func send(board uint8, data []byte) error {
+	l := portsFor(board)
+	if len(l) == 0 {
+		return errors.New("no serial port")
+	}
+	for _, p := range l {
+		select {
+		case p.chTx <- data:
+		case <-p.chEd:
+		}
 	}
-	glog.Infoln(SerialCur.Name, "Closed.")
-	SerialCur.Name = ""
-	chEd <- true
 	return nil
 }
 
+// learnRoute 收到板子的数据包，记下它所在的串口
+func (p *Info) learnRoute(board uint8) {
+	name := p.name()
+	routes.RLock()
+	n, ok := routes.m[board]
+	routes.RUnlock()
+	if ok && n == name {
+		return
+	}
+	routes.Lock()
+	routes.m[board] = name
+	routes.Unlock()
+	glog.Infof("Board %d is on %s\n", board, name)
+}
+
+func (p *Info) name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Name
+}
+
+func (p *Info) port() (Transport, PortState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Port, p.State
+}
+
 // Transmit data
-func Transmit(data []byte) error {
-	glog.V(3).Infoln("serial port write: ", data)
-	_, err := SerialCur.Port.Write(data)
+func (p *Info) Transmit(data []byte) error {
+	port, state := p.port()
+	if state != PortOpen {
+		return errors.New("serial port is " + state.String())
+	}
+	data = p.link.frame(data)
+	glog.V(3).Infoln("write: ", data)
+	_, err := port.Write(data)
 	if err != nil {
 		return err
 	}
@@ -107,9 +301,10 @@ func Transmit(data []byte) error {
 }
 
 // Receive data
-func Receive(buff []byte) ([]byte, error) {
-	n, err := SerialCur.Port.Read(buff)
-	glog.V(5).Infoln("serial port read: ", n)
+func (p *Info) Receive(buff []byte) ([]byte, error) {
+	port, _ := p.port()
+	n, err := port.Read(buff)
+	glog.V(5).Infoln("read: ", n)
 	if err != nil {
 		return nil, err
 	}
@@ -119,104 +314,186 @@ func Receive(buff []byte) ([]byte, error) {
 	return buff[:n], nil
 }
 
-var adding = map[variable.CmdT]time.Time{}
-var deling = map[variable.CmdT]time.Time{}
+// 每次等待修改的正常返回的时间
+const writeTimeout = time.Second
 
-func SendWriteCmd(v variable.T) error {
-	if SerialCur.Port == nil || SerialCur.Name == "" {
-		return errors.New("no serial port")
+// 未收到修改的正常返回时的重发次数
+var optWriteRetry = 2
+
+// 重发次数的上限
+const MaxWriteRetry = 10
+
+// Only call by option. 超出范围的取最近的端点，负数会让写命令一次也不发
+func SetOptWriteRetry(v int) {
+	if v < 0 {
+		v = 0
+	} else if v > MaxWriteRetry {
+		v = MaxWriteRetry
+	}
+	if optWriteRetry == v {
+		glog.V(1).Infof("WriteRetry has set to %d, skip\n", v)
+		return
+	}
+	glog.V(1).Infof("Set WriteRetry to %d\n", v)
+	optWriteRetry = v
+}
+
+// Only call by option.
+func GetOptWriteRetry() int {
+	return optWriteRetry
+}
+
+// SendWriteCmd 发送写命令，未收到修改的正常返回时重发，返回的通道给出最终结果
+func SendWriteCmd(v variable.T) (<-chan error, error) {
+	if len(portsFor(v.Board)) == 0 {
+		return nil, errors.New("no serial port")
+	}
+	if len(v.Fields) != 0 || v.Len() > protocol.DataLen {
+		return nil, ErrSubscribeOnly
 	}
 
 	glog.Infoln("Send write cmd", v)
-	data := variable.MakeWriteCmd(v)
-	chTx <- data
-	return nil
+	done := make(chan error, 1)
+	go func() {
+		done <- writeWithRetry(v)
+	}()
+	return done, nil
 }
 
-func SendCmd(act variable.ActMode, v variable.CmdT) error {
-	if SerialCur.Port == nil || SerialCur.Name == "" {
-		return errors.New("no serial port")
+func writeWithRetry(v variable.T) error {
+	var err error
+	if v.Ptr != nil {
+		// 指针或许已经指向别处，写之前再读一次
+		if v.Addr, err = Deref(v, writeTimeout); err != nil {
+			glog.Errorln("Deref before write failed:", v, err)
+			return err
+		}
 	}
+	k := pendKey{Act: variable.WriteReturn, Board: v.Board, Addr: v.Addr}
+	data := variable.MakeWriteCmd(v)
 
-	if act == variable.Subscribe {
-		if t, ok := adding[v]; ok {
-			if time.Since(t) < 5*time.Second {
-				glog.V(2).Infoln("Has sent subscribe cmd recently", v)
-				return nil
-			}
+	if v.BitSize != 0 {
+		// 位域先读出整个存储单元，改好那几位再写回去
+		var cur variable.CmdT
+		cur, err = ReadValue(variable.CmdT{Board: v.Board, Length: variable.TypeLen[v.Type], Addr: v.Addr}, writeTimeout)
+		if err != nil {
+			glog.Errorln("Read before write failed:", v, err)
+			return err
 		}
-		adding[v] = time.Now()
-	} else if act == variable.Unsubscribe {
-		if t, ok := deling[v]; ok {
-			if time.Since(t) < time.Second {
-				glog.V(2).Infoln("Has sent unsubscribe cmd recently", v)
-				return nil
-			}
+		data = variable.MakeBitsWriteCmd(v, cur.Data)
+	}
+	for i := 0; i <= GetOptWriteRetry(); i++ {
+		if i > 0 {
+			glog.Warningf("Write not acknowledged, retry %d: %v\n", i, v)
+		}
+		_, err = request(variable.Write, data, k, writeTimeout)
+		if err != ErrTimeout {
+			break
 		}
-		deling[v] = time.Now()
 	}
 
+	if err == nil {
+		glog.Infoln("Write acknowledged", v)
+	} else if err == ErrTimeout {
+		// 单片机的错误已经推送过了，这里只推送超时
+		glog.Errorln("Write failed:", v, err)
+		pushStatus(StatusT{
+			Time:  time.Now(),
+			Board: v.Board,
+			Addr:  v.Addr,
+			Act:   variable.Write,
+			Error: err.Error(),
+		})
+	}
+	return err
+}
+
+func SendCmd(act variable.ActMode, v variable.CmdT) error {
 	glog.Infoln("Send cmd", act, v)
 	data := variable.MakeCmd(act, v)
-	chTx <- data
+	if err := send(v.Board, data); err != nil {
+		return err
+	}
+	sent(act, v)
+	variable.SubSent(act, v)
 	return nil
 }
 
-func GrReceive() {
-	buff := make([]byte, 400)
-	var b []byte
-	var err error
+// 一次读取的缓冲区。UDP 每次读出一整个数据报，放不下的就丢了，
+// 所以要容得下最大的数据报，自然也容得下 SLIP 编码后最长的批量帧
+const rxBuffLen = 64 << 10
+
+func (p *Info) grReceive() {
+	buff := make([]byte, rxBuffLen)
 	for {
-		<-chOp
-		glog.V(4).Infoln("chOp...")
-	Loop:
-		for {
+		select {
+		case <-p.chEd:
+			glog.V(4).Infoln("grReceive: got chEd...")
+			return
+		default:
+		}
+
+		b, err := p.Receive(buff)
+		if err != nil {
 			select {
-			case <-chEd:
-				glog.V(4).Infoln("GrReceive: got chEd...")
-				break Loop
+			case <-p.chEd:
+				return
 			default:
-				glog.V(4).Infoln("GrReceive: default...")
-				b, err = Receive(buff)
-				if err != nil {
-					glog.Errorln("GrReceive error:", err)
-				}
-				glog.V(4).Infoln("GrReceive b: ", b)
-				chRx <- b
-				glog.V(4).Infoln("GrReceive: send chRx...")
-				time.Sleep(1000 * time.Microsecond)
 			}
+			// 一直读不到，多半是线松了
+			glog.Errorln("grReceive error:", err)
+			if !p.reconnect() {
+				return
+			}
+			continue
 		}
+		glog.V(4).Infoln("grReceive b: ", b)
+		if len(b) != 0 {
+			// buff 还要接着用，给出去的得是一份拷贝
+			rx := make([]byte, len(b))
+			copy(rx, b)
+			select {
+			case p.chRx <- rx:
+			case <-p.chEd:
+				return
+			}
+		}
+		time.Sleep(1000 * time.Microsecond)
 	}
 }
 
-func GrTransmit() {
-	var err error
-	var data []byte
+func (p *Info) grTransmit() {
 	for {
-		glog.V(4).Infoln("GrTransmit: ")
-		data = <-chTx
-		glog.V(4).Infoln("GrTransmit: got chTx...")
-		err = Transmit(data)
-		if err != nil {
-			glog.Errorln("GrTransmit error: ", err)
+		select {
+		case <-p.chEd:
+			glog.V(4).Infoln("grTransmit: got chEd...")
+			return
+		case data := <-p.chTx:
+			glog.V(4).Infoln("grTransmit: got chTx...")
+			if err := p.Transmit(data); err != nil {
+				glog.Errorln("grTransmit error: ", err)
+			}
+			time.Sleep(3 * time.Millisecond)
 		}
-		time.Sleep(3 * time.Millisecond)
 	}
 }
 
-func GrRxPrase() {
+func (p *Info) grRxPrase() {
 	var rxBuff []byte
-	var idleTimer = time.NewTimer(200 * time.Millisecond)
 	var chart []variable.ChartT
-	var add []variable.CmdT
 	var del []variable.CmdT
-	var vars []variable.CmdT
+	var frames []protocol.Frame
+	var errs []error
+	vars := []variable.CmdT{}
 
 	for {
 		select {
-		case rx := <-chRx: // 收到你的来信
-			glog.V(4).Infoln("GrRxPrase: got chRx...")
+		case <-p.chEd:
+			glog.V(4).Infoln("grRxPrase: got chEd...")
+			return
+
+		case rx := <-p.chRx: // 收到你的来信
+			glog.V(4).Infoln("grRxPrase: got chRx...")
 
 			glog.V(4).Infoln("had buff: ", rxBuff)
 
@@ -226,26 +503,62 @@ func GrRxPrase() {
 
 			// 解开长情的信笺
 			// 残余的信亦不能忘却
-			vars, rxBuff = variable.Unpack(rxBuff)
+			frames, errs, rxBuff = protocol.Unpack(rxBuff)
+			p.link.received(frames, errs)
+			vars = vars[:0]
+			for _, f := range frames {
+				// 批量帧拆成一个个变量，共用同一个时间戳
+				for _, r := range f.Responses() {
+					vars = append(vars, variable.CmdOf(r))
+				}
+			}
 
 			// 所有的酸甜苦辣都值得铭记
 			glog.V(4).Infoln("left buff: ", rxBuff)
 			glog.V(4).Infof("got vars: %v\n", vars)
 
-			if len(vars) > 20 {
-				glog.Fatalln("Too many vars")
+			// 订阅的回音入图表，其余的回应交给等待的人
+			subs := vars[:0]
+			for _, v := range vars {
+				boardSeen(v)
+				p.learnRoute(v.Board)
+				if v.Act == variable.SubscribeReturn {
+					subs = append(subs, v)
+					continue
+				}
+				if variable.IsError(v.Act) {
+					handleError(v)
+					continue
+				}
+				if v.Act == variable.UnsubscribeReturn {
+					variable.SubUnsubscribed(v)
+					continue
+				}
+				if !resolve(pendKey{Act: v.Act, Board: v.Board, Addr: v.Addr}, v) {
+					glog.V(1).Infoln("Unexpected reply", v)
+				}
 			}
 
 			// 拼凑出变量的清单
-			chart, add, del = variable.Filt(vars)
+			chart, _, del = variable.Filt(subs)
 			if len(chart) != 0 {
+				// 重连后串口可能换了名字，在锁内读一次
+				name := p.name()
+				for i := range chart {
+					chart[i].Port = name
+				}
+				record.Write(chart)
 				b, _ := json.Marshal(chart)
-				Chch <- string(b)
+				select {
+				case Chch <- string(b):
+				case <-p.chEd:
+					return
+				}
 			}
 
 			glog.V(3).Infoln("len(chart): ", len(chart))
-			if glog.V(2) && len(add) > 0 || len(del) > 0 {
-				glog.Infof("add: %v, del: %v\n", add, del)
+			if glog.V(2) && len(del) > 0 {
+				glog.Infof("del: %v\n", del)
 			}
 
 			for _, v := range del {
@@ -254,22 +567,57 @@ func GrRxPrase() {
 					glog.Errorln("SendCmd error:", err)
 				}
 			}
+		}
+	}
+}
 
-		case <-(idleTimer.C):
-			idleTimer.Reset(200 * time.Millisecond)
-			if SerialCur.Port == nil || SerialCur.Name == "" {
-				break
+// GrSubscribe 定时订阅挂念着却没有回音的变量，另起一个协程每秒重新读一次指针
+func GrSubscribe() {
+	go grPointers()
+	for {
+		time.Sleep(200 * time.Millisecond)
+		if !IsOpen() {
+			continue
+		}
+		glog.V(4).Infoln("GrSubscribe: time after 200ms...")
+		resubscribe()
+	}
+}
+
+// grPointers 每秒重新读一次指针。读指针要等回应，别耽误了订阅
+func grPointers() {
+	for {
+		time.Sleep(time.Second)
+		if !IsOpen() {
+			continue
+		}
+		refreshPointers()
+	}
+}
+
+// resubscribe 订阅挂念着却没有回音的变量
+func resubscribe() {
+	// 甚是想念
+	_, add, _ := variable.Filt([]variable.CmdT{})
+	glog.V(3).Infoln("add: ", add)
+	for _, v := range add {
+		if isRejected(v) {
+			glog.V(3).Infoln("Rejected by MCU, skip", v)
+			continue
+		}
+		if v.Length > protocol.DataLen {
+			// 宽的值只能由批量帧传回，握手后仍不支持就告诉前端
+			ok, pending := wideReady(v.Board)
+			if !ok && !pending {
+				noBatch(v)
 			}
-			glog.V(4).Infoln("GrRxPrase: time after 200ms...")
-			// 甚是想念
-			_, add, _ := variable.Filt([]variable.CmdT{})
-			glog.V(3).Infoln("add: ", add)
-			for _, v := range add {
-				err := SendCmd(variable.Subscribe, v)
-				if err != nil {
-					glog.Errorln("SendCmd error:", err)
-				}
+			if !ok {
+				continue
 			}
 		}
+		err := SendCmd(variable.Subscribe, v)
+		if err != nil {
+			glog.Errorln("SendCmd error:", err)
+		}
 	}
 }
@@ -0,0 +1,142 @@
+package serial
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// ChStatus 推送给前端的状态Json
+var ChStatus = make(chan string, 100)
+
+// StatusT 是一条状态消息
+type StatusT struct {
+	Time  time.Time
+	Board uint8
+	Addr  uint32
+	Act   variable.ActMode // 引发错误的请求代号
+	Code  variable.ActMode // 错误代号
+	Error string
+}
+
+type addrKey struct {
+	Board uint8
+	Addr  uint32
+}
+
+// 最近发往每个地址的请求，用于找出错误回应是由哪个请求引起的
+var lastSent = struct {
+	sync.Mutex
+	m map[addrKey]variable.ActMode
+}{
+	m: map[addrKey]variable.ActMode{},
+}
+
+// 需要批量帧却没法订阅、已经告诉过前端的变量
+var unbatched = struct {
+	sync.Mutex
+	m map[addrKey]bool
+}{
+	m: map[addrKey]bool{},
+}
+
+// 单片机永远不会接受的订阅
+var rejected = struct {
+	sync.Mutex
+	m map[addrKey]*variable.MCUError
+}{
+	m: map[addrKey]*variable.MCUError{},
+}
+
+func sent(act variable.ActMode, v variable.CmdT) {
+	lastSent.Lock()
+	defer lastSent.Unlock()
+	lastSent.m[addrKey{v.Board, v.Addr}] = act
+}
+
+// isRejected 判断该订阅是否已被单片机永久拒绝
+func isRejected(v variable.CmdT) bool {
+	rejected.Lock()
+	defer rejected.Unlock()
+	_, ok := rejected.m[addrKey{v.Board, v.Addr}]
+	return ok
+}
+
+// resetRejected 串口重新打开后，再给它们一次机会
+func resetRejected() {
+	rejected.Lock()
+	defer rejected.Unlock()
+	rejected.m = map[addrKey]*variable.MCUError{}
+
+	unbatched.Lock()
+	defer unbatched.Unlock()
+	unbatched.m = map[addrKey]bool{}
+}
+
+// noBatch 宽的值只能由批量帧传回，链路不支持时由上位机告诉前端，每个变量只说一次。
+// 这不是单片机的错误，也不算单片机拒绝，换上支持的固件后重新打开串口即可订阅
+func noBatch(v variable.CmdT) {
+	k := addrKey{v.Board, v.Addr}
+	unbatched.Lock()
+	told := unbatched.m[k]
+	unbatched.m[k] = true
+	unbatched.Unlock()
+	if told {
+		return
+	}
+
+	glog.Warningf("Board %d does not send batch frames, cannot subscribe %d bytes at %08X\n", v.Board, v.Length, v.Addr)
+	pushStatus(StatusT{
+		Time:  time.Now(),
+		Board: v.Board,
+		Addr:  v.Addr,
+		Act:   variable.Subscribe,
+		Error: ErrNoBatch.Error(),
+	})
+}
+
+// handleError 处理单片机返回的错误
+func handleError(v variable.CmdT) {
+	k := addrKey{v.Board, v.Addr}
+	lastSent.Lock()
+	act := lastSent.m[k]
+	lastSent.Unlock()
+
+	e := &variable.MCUError{Code: v.Act, Act: act, Cmd: v}
+	glog.Errorln("MCU error:", e)
+
+	// 要取消的订阅本就不存在，也算取消了
+	if e.Code == variable.NoSuchAddrReg {
+		variable.SubUnsubscribed(v)
+	}
+
+	if e.Act == variable.Subscribe && e.Permanent() {
+		rejected.Lock()
+		rejected.m[k] = e
+		rejected.Unlock()
+	}
+
+	reject(v.Board, v.Addr, e)
+
+	pushStatus(StatusT{
+		Time:  time.Now(),
+		Board: v.Board,
+		Addr:  v.Addr,
+		Act:   e.Act,
+		Code:  e.Code,
+		Error: e.Error(),
+	})
+}
+
+// pushStatus 推送状态，没人接收时丢弃
+func pushStatus(s StatusT) {
+	b, _ := json.Marshal(s)
+	select {
+	case ChStatus <- string(b):
+	default:
+		glog.V(2).Infoln("status dropped:", string(b))
+	}
+}
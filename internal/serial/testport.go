@@ -4,13 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.bug.st/serial"
 
 	"github.com/golang/glog"
 	"github.com/scutrobotlab/asuwave/internal/variable"
-	"github.com/scutrobotlab/asuwave/pkg/slip"
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
 )
 
 /**
@@ -31,24 +33,44 @@ var vartypeMap = map[uint32]string{
 	8: "int64_t",
 }
 
-var (
-	chAddr                         = make(chan bool, 10) // 修改通知
-	addresses    map[uint32]bool   = map[uint32]bool{}   // 观察的地址
-	writeData    map[uint32][]byte = map[uint32][]byte{} // 直接写入数据
-	BoardSysTime time.Time         = time.Now()          // 虚拟电路板的系统时间
-)
+// 虚拟电路板的内存，直接写入的数据在关闭串口后还在
+var writeData = struct {
+	sync.Mutex
+	m map[addrKey][]byte
+}{m: map[addrKey][]byte{}}
+
+var BoardSysTime time.Time = time.Now() // 虚拟电路板的系统时间
+
+// 每次打开都是一块新连上的虚拟电路板，旧的定时回应不会落到新的上
+type testPort struct {
+	sync.Mutex
+	addresses map[addrKey]uint8 // 观察的地址与长度
+	replies   []byte            // 待发送的一次性回应
+	closed    bool
 
-type testPort struct{}
+	chAddr chan struct{} // 修改通知
+	chEd   chan struct{} // 已关闭
+
+	version, seq, caps uint32 // 使用的协议版本、发出的帧序号与接受的能力
+}
 
 func newTestPort() serial.Port {
 	glog.Infoln("TestPort open at: ", BoardSysTime)
-	return &testPort{}
+	return &testPort{
+		addresses: map[addrKey]uint8{},
+		chAddr:    make(chan struct{}, 1),
+		chEd:      make(chan struct{}),
+		version:   uint32(protocol.V1),
+	}
 }
 
 func (tp *testPort) SetMode(mode *serial.Mode) error { return nil }
 
-func testValue(x float64, addr uint32) []byte {
-	if data, ok := writeData[addr]; ok {
+func testValue(x float64, board uint8, addr uint32) []byte {
+	writeData.Lock()
+	data, ok := writeData.m[addrKey{board, addr}]
+	writeData.Unlock()
+	if ok {
 		return data
 	}
 
@@ -106,68 +128,207 @@ func testValue(x float64, addr uint32) []byte {
 	return make([]byte, 8)
 }
 
+// 虚拟电路板的一个回应
+func (tp *testPort) testReply(board uint8, act variable.ActMode, length uint8, addr uint32) []byte {
+	t := time.Since(BoardSysTime)
+	r := protocol.Response{
+		Board:  board,                    // 单片机代号 board
+		Act:    act,                      // 响应或错误代号 act
+		Length: length,                   // 数据长度 length
+		Addr:   addr,                     // 单片机地址
+		Tick:   uint32(t.Milliseconds()), // 时间戳
+	}
+	copy(r.Data[:], testValue(t.Seconds(), board, addr)) // 数据
+	return tp.testPack(r)
+}
+
+// 按协商好的版本编码
+func (tp *testPort) testPack(r protocol.Response) []byte {
+	if atomic.LoadUint32(&tp.version) == uint32(protocol.V2) {
+		return r.PackV2(uint8(atomic.AddUint32(&tp.seq, 1)))
+	}
+	return r.Pack()
+}
+
+// later 过一会儿在锁内改动虚拟电路板并通知 Read，关闭后不再改动
+func (tp *testPort) later(d time.Duration, f func()) {
+	time.AfterFunc(d, func() {
+		tp.Lock()
+		if tp.closed {
+			tp.Unlock()
+			return
+		}
+		f()
+		tp.Unlock()
+		select {
+		case tp.chAddr <- struct{}{}:
+		default:
+		}
+	})
+}
+
+func (tp *testPort) addReply(b []byte) {
+	tp.replies = append(tp.replies, b...)
+}
+
 func (tp *testPort) Read(p []byte) (n int, err error) {
-	for len(addresses) == 0 {
-		if _, ok := <-chAddr; !ok {
+	tp.Lock()
+	for len(tp.addresses) == 0 && len(tp.replies) == 0 {
+		tp.Unlock()
+		select {
+		case <-tp.chAddr:
+		case <-tp.chEd:
 			return 0, nil
 		}
+		tp.Lock()
 	}
-	data := make([]byte, 0, len(addresses)*40)
-
-	i := 0
-	for addr := range addresses {
-		var pdu [20]byte
-		pdu[0] = 1                                // 单片机代号 board
-		pdu[1] = 2                                // 响应或错误代号 act (0x02 = 订阅的正常返回)
-		pdu[2] = 8                                // 数据长度 length
-		copy(pdu[3:7], variable.AnyToBytes(addr)) // 单片机地址
-		t := time.Since(BoardSysTime)
-		x := t.Seconds()
-		u := t.Milliseconds()
-		y := testValue(x, addr)
-		copy(pdu[7:15], y)                               // 数据
-		copy(pdu[15:19], variable.AnyToBytes(uint32(u))) // 时间戳
-		pdu[19] = '\n'                                   // 尾部固定为0x0a
-		i++
-		sdu := slip.Pack(pdu[:])
-		data = append(data, sdu...)
+	defer tp.Unlock()
+
+	data := make([]byte, 0, len(tp.addresses)*40)
+	data = append(data, tp.replies...)
+	tp.replies = nil
+
+	if tp.testBatch() {
+		data = append(data, tp.testBatchReply()...)
+		return copy(p, data), nil
+	}
+
+	for k := range tp.addresses {
+		// 0x02 = 订阅的正常返回
+		data = append(data, tp.testReply(k.Board, variable.SubscribeReturn, 8, k.Addr)...)
 	}
 
 	return copy(p, data), nil
 }
 
+// 协商好了 v2 批量帧
+func (tp *testPort) testBatch() bool {
+	return atomic.LoadUint32(&tp.version) == uint32(protocol.V2) &&
+		uint8(atomic.LoadUint32(&tp.caps))&protocol.CapBatch != 0
+}
+
+// 宽的值由一个个同类型的值连成，与逐个订阅时一样
+func testWide(x float64, board uint8, addr uint32, n uint8) []byte {
+	size := uint32(variable.TypeLen[vartypeMap[(addr>>28)&0xF]])
+	if size == 0 {
+		size = 8
+	}
+	data := []byte{}
+	for a := addr; len(data) < int(n); a += size {
+		v := testValue(x, board, a)
+		data = append(data, v[:size]...)
+	}
+	return data[:n]
+}
+
+// 同一块板子的订阅变量合成批量帧，每帧至多 MaxBatch 个，须在锁内调用
+func (tp *testPort) testBatchReply() []byte {
+	t := time.Since(BoardSysTime)
+	tick := uint32(t.Milliseconds())
+	boards := map[uint8][]protocol.Response{}
+	for k, n := range tp.addresses {
+		r := protocol.Response{Board: k.Board, Act: protocol.SubscribeReturn, Length: 8, Addr: k.Addr, Tick: tick}
+		copy(r.Data[:], testValue(t.Seconds(), k.Board, k.Addr))
+		if n > protocol.DataLen {
+			r.Length = n
+			r.Wide = testWide(t.Seconds(), k.Board, k.Addr, n)
+		}
+		boards[k.Board] = append(boards[k.Board], r)
+	}
+	var data []byte
+	for board, l := range boards {
+		for len(l) > 0 {
+			n := len(l)
+			if n > protocol.MaxBatch {
+				n = protocol.MaxBatch
+			}
+			data = append(data, protocol.PackBatch(board, tick, uint8(atomic.AddUint32(&tp.seq, 1)), l[:n])...)
+			l = l[n:]
+		}
+	}
+	return data
+}
+
 func (tp *testPort) Write(p []byte) (n int, err error) {
-	if p[len(p)-1] != '\n' {
-		return 0, errors.New("invalid package")
+	var req protocol.Request
+	if len(p) == protocol.RequestV2Len {
+		req, _, err = protocol.DecodeRequestV2(p)
+	} else {
+		req, err = protocol.DecodeRequest(p)
 	}
-	board := p[0]
+	if err != nil {
+		return 0, err
+	}
+	board := req.Board
 	glog.Infoln("Got write: board = ", board)
-	act := variable.ActMode(p[1])
+	act := req.Act
 	glog.Infoln("Got write: act = ", act)
-	length := p[2]
+	length := req.Length
 	glog.Infoln("Got write: length = ", length)
-	address := variable.BytesToUint32(p[3:7])
+	address := req.Addr
 	glog.Infoln("Got write: address = ", address)
-	data := p[7:15]
+	data := req.Data[:]
+
+	// 虚拟电路板有三块，都只认得 0x20000000 以上的地址
+	var code variable.ActMode
+	if board < variable.Board1 || board > variable.Board3 {
+		code = variable.NoSuchBoard
+	} else if address < 0x20000000 && act != protocol.Hello {
+		code = variable.NoSuchAddr
+	}
+	if code != 0 {
+		tp.later(10*time.Millisecond, func() {
+			tp.addReply(tp.testReply(board, code, length, address))
+			glog.Infof("Reply error %02X: %08X\n", code, address)
+		})
+		return len(p), nil
+	}
 
 	switch act {
+	case protocol.Hello:
+		tp.later(10*time.Millisecond, func() {
+			// 以 v1 回应，此后改用 v2，能力全都接受
+			r := protocol.Response{Board: board, Act: protocol.HelloReturn}
+			r.Data[0] = protocol.V2
+			r.Data[1] = data[1] & protocol.CapBatch
+			atomic.StoreUint32(&tp.caps, uint32(r.Data[1]))
+			tp.addReply(r.Pack())
+			atomic.StoreUint32(&tp.version, uint32(protocol.V2))
+			glog.Infoln("Hello, use protocol v2")
+		})
+
 	case variable.Subscribe:
-		go time.AfterFunc(500*time.Millisecond, func() {
-			addresses[address] = true
-			chAddr <- true
+		if length > protocol.DataLen && !tp.testBatch() {
+			// 宽的值只能放进批量帧
+			tp.later(10*time.Millisecond, func() {
+				tp.addReply(tp.testReply(board, variable.NoSuchDataNum, length, address))
+			})
+			break
+		}
+		tp.later(500*time.Millisecond, func() {
+			tp.addresses[addrKey{board, address}] = length
 			glog.Infof("Adding address: %08X\n", address)
 		})
 
 	case variable.Unsubscribe:
-		go time.AfterFunc(500*time.Millisecond, func() {
-			delete(addresses, address)
-			chAddr <- true
+		tp.later(500*time.Millisecond, func() {
+			delete(tp.addresses, addrKey{board, address})
+			tp.addReply(tp.testReply(board, variable.UnsubscribeReturn, length, address))
 			glog.Infof("Deleting address: %08X\n", address)
 		})
 
+	case variable.Read:
+		tp.later(10*time.Millisecond, func() {
+			tp.addReply(tp.testReply(board, variable.ReadReturn, length, address))
+			glog.Infof("Reading address: %08X\n", address)
+		})
+
 	case variable.Write:
-		go time.AfterFunc(500*time.Millisecond, func() {
-			writeData[address] = data
+		tp.later(500*time.Millisecond, func() {
+			writeData.Lock()
+			writeData.m[addrKey{board, address}] = data
+			writeData.Unlock()
+			tp.addReply(tp.testReply(board, variable.WriteReturn, length, address))
 			glog.Infof("Writing address: %08X = %v\n", address, data)
 		})
 
@@ -175,7 +336,7 @@ func (tp *testPort) Write(p []byte) (n int, err error) {
 		return 0, errors.New(fmt.Sprint("invalid act: ", act))
 	}
 
-	return 16, nil
+	return len(p), nil
 }
 
 func (tp *testPort) ResetInputBuffer() error { return nil }
@@ -193,6 +354,11 @@ func (tp *testPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
 }
 
 func (tp *testPort) Close() error {
-	close(chAddr)
+	tp.Lock()
+	defer tp.Unlock()
+	if !tp.closed {
+		tp.closed = true
+		close(tp.chEd)
+	}
 	return nil
 }
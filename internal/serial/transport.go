@@ -0,0 +1,50 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Transport 是收发数据包的通道，可以是串口，也可以是网络。
+// 数据包的格式与 SLIP 编码在各种通道上都一样
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// 连接网络时等待的时间
+const dialTimeout = 3 * time.Second
+
+// isNetwork 判断名字是不是网络地址，如 tcp://192.168.4.1:5000
+func isNetwork(name string) bool {
+	return strings.HasPrefix(name, "tcp://") || strings.HasPrefix(name, "udp://")
+}
+
+// openTransport 按名字打开通道：虚拟串口、网络地址或是真正的串口
+func openTransport(name string, mode *serial.Mode) (Transport, error) {
+	if name == testPortName {
+		return newTestPort(), nil
+	}
+	if isNetwork(name) {
+		return dial(name)
+	}
+	return serial.Open(name, mode)
+}
+
+// dial 连接网络上的板子。
+// TCP 是字节流，与串口无异；UDP 每个数据报含若干完整的 SLIP 帧
+func dial(name string) (Transport, error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" || u.Port() == "" {
+		return nil, errors.New("invalid address, want tcp://host:port or udp://host:port: " + name)
+	}
+	return net.DialTimeout(u.Scheme, u.Host, dialTimeout)
+}
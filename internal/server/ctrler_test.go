@@ -6,11 +6,32 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/variable"
 )
 
+// 测试时的配置文件夹，不去动用户的设置、变量列表与文件监视列表
+var testDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	testDir, err = os.MkdirTemp("", "asuwave-server-test")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	option.SetDir(testDir)
+	variable.SetDir(testDir)
+	code := m.Run()
+	os.RemoveAll(testDir)
+	os.Exit(code)
+}
+
 type casesT []struct {
 	method   string
 	url      string
@@ -57,3 +78,14 @@ func ctrlerTest(ctrler func(http.ResponseWriter, *http.Request), cases casesT, t
 			body)
 	}
 }
+
+// serve 发出一个请求，返回状态码与响应
+func serve(ctrler func(http.ResponseWriter, *http.Request), method, url string, body interface{}) (int, string) {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, strings.NewReader(string(b)))
+	w := httptest.NewRecorder()
+	ctrler(w, req)
+	resp := w.Result()
+	s, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(s)
+}
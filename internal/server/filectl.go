@@ -6,24 +6,25 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/scutrobotlab/asuwave/internal/option"
 	"github.com/scutrobotlab/asuwave/internal/variable"
 	"github.com/scutrobotlab/asuwave/pkg/elffile"
 )
 
-// 上传elf或axf文件
+// 上传elf或axf文件，board 为空时对所有电路板适用
 func fileUploadCtrl(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case http.MethodPut:
-		err := elffile.RemoveWathcer()
+		r.ParseMultipartForm(32 << 20)
+		board, err := queryBoard(r.Form, variable.AllBoards)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
 
-		r.ParseMultipartForm(32 << 20)
 		file, _, err := r.FormFile("file")
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -39,24 +40,23 @@ func fileUploadCtrl(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		defer os.Remove(tempFile.Name())
+		defer tempFile.Close()
 
 		io.Copy(tempFile, file)
 
-		f, err := elffile.Check(tempFile)
-		if err != nil {
+		if err := elffile.LoadFile(board, tempFile); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
-		defer f.Close()
 
-		projs, err := elffile.ReadVariable(f)
-		if err != nil {
+		// 上传的文件取代这块板子原来监视的文件
+		if err := elffile.Unwatch(board); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
-		variable.SetAllProj(projs)
+		option.SaveWatchList()
 
 		w.WriteHeader(http.StatusNoContent)
 		io.WriteString(w, "")
@@ -66,7 +66,7 @@ func fileUploadCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// 监控elf或axf文件
+// 监控elf或axf文件，每块电路板一个
 func filePathCtrl(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	w.Header().Set("Content-Type", "application/json")
@@ -77,9 +77,7 @@ func filePathCtrl(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, string(b))
 
 	case http.MethodPut:
-		j := struct {
-			Path string
-		}{}
+		var j elffile.WatchT // 未指定板子时，对所有电路板适用
 		data, _ := io.ReadAll(r.Body)
 		err := json.Unmarshal(data, &j)
 		if err != nil {
@@ -88,49 +86,96 @@ func filePathCtrl(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		file, err := os.Open(j.Path)
-		if err != nil {
+		if err := elffile.Load(j.Board, j.Path); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
 
-		f, err := elffile.Check(file)
-		if err != nil {
+		if err := elffile.Watch(j.Board, j.Path); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
-		defer f.Close()
+		option.SaveWatchList()
+
+		w.WriteHeader(http.StatusNoContent)
+		io.WriteString(w, "")
 
-		projs, err := elffile.ReadVariable(f)
+	case http.MethodDelete:
+		// 指定了板子时只卸下它的，否则全部卸下，工程变量与内存区域一并清除
+		q := r.URL.Query()
+		board, err := queryBoard(q, variable.AllBoards)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
-		variable.SetAllProj(projs)
-
-		elffile.ChFileWatch <- j.Path
+		if q.Has("board") {
+			err = elffile.Unload(board)
+		} else {
+			err = elffile.UnloadAll()
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
+		option.SaveWatchList()
 
 		w.WriteHeader(http.StatusNoContent)
 		io.WriteString(w, "")
 
-	case http.MethodDelete:
-		err := elffile.RemoveWathcer()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// 认得的目标平台
+func fileTargetCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		type targetT struct {
+			Name      string
+			Class     string
+			Machine   []string
+			AddrBytes int
+			RAM       elffile.Regions
+		}
+		j := []targetT{}
+		for _, t := range elffile.Targets {
+			m := []string{}
+			for _, v := range t.Machine {
+				m = append(m, v.String())
+			}
+			j = append(j, targetT{t.Name, t.Class.String(), m, t.AddrBytes, t.RAM})
+		}
+		b, _ := json.Marshal(j)
+		io.WriteString(w, string(b))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// 电路板的工程文件的内存区域
+func fileMemoryCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		board, err := queryBoard(r.URL.Query(), variable.AllBoards)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, errorJson(err.Error()))
 			return
 		}
-
-		w.WriteHeader(http.StatusNoContent)
-		io.WriteString(w, "")
+		b, _ := json.Marshal(elffile.GetMemoryMap(board))
+		io.WriteString(w, string(b))
 
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
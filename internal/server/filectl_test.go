@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/elffile"
+)
+
+func TestFileTargetCtrl(t *testing.T) {
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/file/target",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodPut,
+			"/file/target",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(fileTargetCtrl, cases, t)
+}
+
+func TestFileMemoryCtrl(t *testing.T) {
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/file/memory",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodDelete,
+			"/file/memory",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(fileMemoryCtrl, cases, t)
+}
+
+func TestFileUnloadBoard(t *testing.T) {
+	// 清除时会保存文件监视列表，放到临时文件夹里
+	dir := t.TempDir()
+	option.SetDir(dir)
+	variable.SetDir(dir)
+	defer option.SetDir(testDir)
+	defer variable.SetDir(testDir)
+
+	// 按板子清除工程文件或工程变量，工程变量、内存区域与监视一起卸下
+	for _, c := range []struct {
+		ctrl func(http.ResponseWriter, *http.Request)
+		url  string
+	}{
+		{filePathCtrl, "/file/path?board=2"},
+		{variableToProjCtrl, "/variable_proj?board=2"},
+	} {
+		variable.SetAllProj(variable.Board2, variable.Projs{"a": {Name: "a", Addr: "0x30000000", Type: "int"}})
+		elffile.SetMemoryMap(variable.Board2, elffile.Regions{{Name: ".bss", Start: 0x30000000, End: 0x30000100}})
+		elffile.Watch(variable.Board2, "a.axf")
+
+		if code, body := serve(c.ctrl, http.MethodDelete, c.url, nil); code != http.StatusNoContent {
+			t.Fatalf("DELETE %s: %d %s", c.url, code, body)
+		}
+		if _, ok := variable.GetProj(variable.Board2, "a"); ok {
+			t.Errorf("%s: projs left", c.url)
+		}
+		if _, err := elffile.CheckAddr(variable.Board2, 0x08000000, 4); err != nil {
+			t.Errorf("%s: memory map left", c.url)
+		}
+		if l := elffile.GetWatchList(); len(l) != 0 {
+			t.Errorf("%s: watch list %v", c.url, l)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "FileWatch.json")); err != nil {
+		t.Errorf("watch list not saved in %s: %v", dir, err)
+	}
+}
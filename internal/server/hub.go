@@ -0,0 +1,106 @@
+package server
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// 每个客户端最多积压的消息数
+const hubQueueLen = 64
+
+// hubClient 是订阅了广播的一个客户端，拥有自己的有界队列
+type hubClient struct {
+	Addr    string      // 客户端地址
+	queue   chan string // 待发送的消息
+	dropped uint64      // 因积压而丢弃的消息数
+}
+
+// hub 将一路消息分发给所有订阅的客户端，慢客户端只会丢弃自己最旧的消息，不会拖慢其他客户端
+type hub struct {
+	sync.Mutex
+	clients map[*hubClient]bool
+}
+
+// ClientStat 是一个客户端的统计信息
+type ClientStat struct {
+	Addr    string
+	Queued  int
+	Dropped uint64
+}
+
+var dataHub = newHub()   // 图表数据
+var statusHub = newHub() // 单片机的错误等状态
+
+func newHub() *hub {
+	return &hub{clients: map[*hubClient]bool{}}
+}
+
+// Subscribe 注册一个新的客户端
+func (h *hub) Subscribe(addr string) *hubClient {
+	h.Lock()
+	defer h.Unlock()
+	c := &hubClient{
+		Addr:  addr,
+		queue: make(chan string, hubQueueLen),
+	}
+	h.clients[c] = true
+	glog.V(1).Infoln("hub subscribe:", addr)
+	return c
+}
+
+// Unsubscribe 注销客户端
+func (h *hub) Unsubscribe(c *hubClient) {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	glog.V(1).Infof("hub unsubscribe: %s, dropped %d\n", c.Addr, c.dropped)
+}
+
+// Broadcast 把消息放入每个客户端的队列，队列已满则丢弃该客户端最旧的一条
+func (h *hub) Broadcast(msg string) {
+	h.Lock()
+	defer h.Unlock()
+	for c := range h.clients {
+		for {
+			select {
+			case c.queue <- msg:
+			default:
+				select {
+				case <-c.queue:
+					c.dropped++
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// Stats 返回每个客户端的积压和丢弃数
+func (h *hub) Stats() []ClientStat {
+	h.Lock()
+	defer h.Unlock()
+	stats := []ClientStat{}
+	for c := range h.clients {
+		stats = append(stats, ClientStat{
+			Addr:    c.Addr,
+			Queued:  len(c.queue),
+			Dropped: c.dropped,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Addr < stats[j].Addr })
+	return stats
+}
+
+// Run 从 ch 读取消息并分发，直到 ch 被关闭
+func (h *hub) Run(ch <-chan string) {
+	for msg := range ch {
+		h.Broadcast(msg)
+	}
+}
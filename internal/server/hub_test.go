@@ -0,0 +1,40 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHubDropOldest(t *testing.T) {
+	h := newHub()
+	fast := h.Subscribe("fast")
+	slow := h.Subscribe("slow")
+
+	n := hubQueueLen + 10
+	for i := 0; i < n; i++ {
+		h.Broadcast(strconv.Itoa(i))
+		<-fast.queue
+	}
+
+	stats := h.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("len(stats) == %d, want 2", len(stats))
+	}
+	if stats[0].Addr != "fast" || stats[0].Dropped != 0 || stats[0].Queued != 0 {
+		t.Errorf("fast client stat: %+v", stats[0])
+	}
+	if stats[1].Addr != "slow" || stats[1].Dropped != 10 || stats[1].Queued != hubQueueLen {
+		t.Errorf("slow client stat: %+v", stats[1])
+	}
+
+	// 最旧的已被丢弃，队首应为第 10 条
+	if msg := <-slow.queue; msg != "10" {
+		t.Errorf("slow client got %s, want 10", msg)
+	}
+
+	h.Unsubscribe(slow)
+	h.Broadcast("x")
+	if len(h.Stats()) != 1 {
+		t.Errorf("unsubscribed client still in hub")
+	}
+}
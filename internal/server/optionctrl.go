@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/serial"
 )
 
 func optionCtrl(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +63,22 @@ func optionCtrl(w http.ResponseWriter, r *http.Request) {
 				io.WriteString(w, errorJson("Invaild value"))
 				return
 			}
+		case "WriteRetry":
+			if v, err := strconv.Atoi(value); err == nil && v >= 0 && v <= serial.MaxWriteRetry {
+				option.SetWriteRetry(v)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild value"))
+				return
+			}
+		case "ProtocolV2":
+			if v, err := strconv.ParseBool(value); err == nil {
+				option.SetProtocolV2(v)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild value"))
+				return
+			}
 		default:
 			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, errorJson("Unfound key: "+j.Key))
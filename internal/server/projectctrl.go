@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/scutrobotlab/asuwave/internal/project"
+)
+
+// 工程：GET 列出，POST 新建，PUT 切换，DELETE 删除
+func projectCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		list, err := project.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		b, _ := json.Marshal(list)
+		io.WriteString(w, string(b))
+		return
+	}
+
+	var do func(string) error
+	switch r.Method {
+	case http.MethodPost:
+		do = project.Create
+	case http.MethodPut:
+		do = project.Switch
+	case http.MethodDelete:
+		do = project.Delete
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+
+	j := struct {
+		Name string
+	}{}
+	data, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(data, &j); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, errorJson("Invaild json"))
+		return
+	}
+	if err := do(j.Name); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, errorJson(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	io.WriteString(w, "")
+}
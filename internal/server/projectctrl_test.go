@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/project"
+)
+
+func TestProjectCtrl(t *testing.T) {
+	project.Root = t.TempDir()
+	project.Load()
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/project",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodPost,
+			"/project",
+			struct{ Name string }{Name: "gimbal"},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodPost,
+			"/project",
+			struct{ Name string }{Name: "gimbal"},
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPut,
+			"/project",
+			struct{ Name string }{Name: "gimbal"},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodDelete,
+			"/project",
+			struct{ Name string }{Name: "gimbal"},
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPut,
+			"/project",
+			struct{ Name string }{Name: project.Default},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodDelete,
+			"/project",
+			struct{ Name string }{Name: "gimbal"},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodPut,
+			"/project",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPatch,
+			"/project",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(projectCtrl, cases, t)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/scutrobotlab/asuwave/internal/record"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 图表数据的记录
+func recordCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		list, err := record.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		b, _ := json.Marshal(list)
+		io.WriteString(w, string(b))
+
+	case http.MethodPost:
+		j := struct {
+			Name string
+		}{}
+		data, _ := io.ReadAll(r.Body)
+		if len(data) != 0 {
+			if err := json.Unmarshal(data, &j); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild json"))
+				return
+			}
+		}
+		name, err := record.Start(j.Name)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		j.Name = name
+		b, _ := json.Marshal(j)
+		io.WriteString(w, string(b))
+
+	case http.MethodDelete:
+		if err := record.Stop(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		io.WriteString(w, "")
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// 通过 /dataws 重放记录
+func replayCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		j := struct{ Name string }{Name: record.Replaying()}
+		b, _ := json.Marshal(j)
+		io.WriteString(w, string(b))
+
+	case http.MethodPost:
+		j := struct {
+			Name  string
+			Speed float64
+		}{}
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &j); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson("Invaild json"))
+			return
+		}
+		err := record.Replay(j.Name, j.Speed, func(chart []variable.ChartT) {
+			b, _ := json.Marshal(chart)
+			dataHub.Broadcast(string(b))
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		io.WriteString(w, "")
+
+	case http.MethodDelete:
+		if err := record.StopReplay(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		io.WriteString(w, "")
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// 导出记录，供 Python/MATLAB 分析
+func exportCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		name := q.Get("name")
+		opt := record.ExportOpt{}
+		if v := q.Get("from"); v != "" {
+			from, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild from"))
+				return
+			}
+			opt.From = uint32(from)
+		}
+		if v := q.Get("to"); v != "" {
+			to, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild to"))
+				return
+			}
+			opt.To = uint32(to)
+		}
+		if v := q.Get("vars"); v != "" {
+			opt.Names = strings.Split(v, ",")
+		}
+		opt.Raw, _ = strconv.ParseBool(q.Get("raw"))
+
+		export := record.ExportCSV
+		filename := name + ".csv"
+		contentType := "text/csv"
+		switch q.Get("format") {
+		case "", "csv":
+		case "col":
+			export = record.ExportColumnar
+			filename = name + ".col"
+			contentType = "application/octet-stream"
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson("Unknown format: "+q.Get("format")))
+			return
+		}
+
+		// 先整个生成出来，出错时还能返回错误码
+		var b strings.Builder
+		if err := export(name, opt, &b); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		io.WriteString(w, b.String())
+
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/record"
+)
+
+func TestRecordCtrl(t *testing.T) {
+	record.Dir = t.TempDir()
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/record",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodPost,
+			"/record",
+			struct{ Name string }{Name: "test"},
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/record",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodDelete,
+			"/record",
+			nil,
+			http.StatusNoContent,
+		},
+		{
+			http.MethodPut,
+			"/record",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(recordCtrl, cases, t)
+}
+
+func TestReplayCtrl(t *testing.T) {
+	record.Dir = t.TempDir()
+	record.Start("test")
+	record.Stop()
+	cases := casesT{
+		{
+			http.MethodPost,
+			"/record/replay",
+			struct {
+				Name  string
+				Speed float64
+			}{Name: "test", Speed: 10},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodGet,
+			"/record/replay",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodPost,
+			"/record/replay",
+			struct{ Name string }{Name: "unfound"},
+			http.StatusBadRequest,
+		},
+	}
+	ctrlerTest(replayCtrl, cases, t)
+}
+
+func TestExportCtrl(t *testing.T) {
+	record.Dir = t.TempDir()
+	record.Start("test")
+	record.Stop()
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/export?name=test&from=0&to=100&vars=a,b",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/export?name=test&format=col&raw=true",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/export?name=test&format=xlsx",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodGet,
+			"/export?name=unfound",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPost,
+			"/export",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(exportCtrl, cases, t)
+}
@@ -11,6 +11,7 @@ import (
 type SerialSetting struct {
 	Serial string
 	Baud   int
+	Boards []uint8 // 连接在此串口上的板子，可不填，收到数据包后自会知晓
 }
 
 // serialCtrl 处理与序列相关的HTTP请求。
@@ -48,13 +49,9 @@ func serialCurCtrl(w http.ResponseWriter, r *http.Request) {
 	// 根据请求的HTTP方法进行处理。
 	switch r.Method {
 	case http.MethodGet:
-		// 当请求方法为GET时，获取当前的串口设置并返回。
-		j := SerialSetting{
-			Serial: serial.SerialCur.Name,          // 获取当前串口的名称。
-			Baud:   serial.SerialCur.Mode.BaudRate, // 获取当前波特率。
-		}
-		b, _ := json.Marshal(j)      // 将结果转换为JSON格式。
-		io.WriteString(w, string(b)) // 将JSON写入响应。
+		// 当请求方法为GET时，获取所有已打开串口的设置并返回。
+		b, _ := json.Marshal(serial.List()) // 将结果转换为JSON格式。
+		io.WriteString(w, string(b))        // 将JSON写入响应。
 
 	case http.MethodPost:
 		// 当请求方法为POST时，读取请求体中的JSON数据并尝试打开新的串口连接。
@@ -68,8 +65,8 @@ func serialCurCtrl(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// 尝试使用请求中提供的串口设置打开新的串口连接。
-		err = serial.Open(j.Serial, j.Baud)
+		// 尝试使用请求中提供的串口设置再打开一个串口连接。
+		err = serial.Open(j.Serial, j.Baud, j.Boards...)
 		if err != nil {
 			// 如果打开串口失败，则返回500 Internal Server Error。
 			w.WriteHeader(http.StatusInternalServerError)
@@ -79,8 +76,22 @@ func serialCurCtrl(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, string(postData)) // 将原始POST数据写入响应。
 
 	case http.MethodDelete:
-		// 当请求方法为DELETE时，尝试关闭当前的串口连接。
-		err = serial.Close()
+		// 当请求方法为DELETE时，尝试关闭指定的串口连接，未指定时关闭所有串口。
+		j := SerialSetting{}
+		postData, _ := io.ReadAll(r.Body)
+		if len(postData) != 0 {
+			err = json.Unmarshal(postData, &j)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild json"))
+				return
+			}
+		}
+		if j.Serial == "" {
+			err = serial.CloseAll()
+		} else {
+			err = serial.Close(j.Serial)
+		}
 		if err != nil {
 			// 如果关闭串口失败，则返回500 Internal Server Error。
 			w.WriteHeader(http.StatusInternalServerError)
@@ -97,3 +108,19 @@ func serialCurCtrl(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
 	}
 }
+
+// boardsCtrl 返回每块电路板的通信状况。
+func boardsCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		b, _ := json.Marshal(serial.GetBoards())
+		io.WriteString(w, string(b))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
@@ -1,10 +1,16 @@
 package server
 
 import (
+	"encoding/json"
+	"net"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/scutrobotlab/asuwave/internal/serial"
+	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
 )
 
 func TestSerialCtrl(t *testing.T) {
@@ -37,10 +43,15 @@ func TestSerialCtrl(t *testing.T) {
 	ctrlerTest(serialCtrl, cases, t)
 }
 
+// 订阅的协程整个测试只起一个
+var subscribeOnce sync.Once
+
+func startSubscribe() {
+	subscribeOnce.Do(func() { go serial.GrSubscribe() })
+}
+
 func TestSerialCurCtrl(t *testing.T) {
-	go serial.GrReceive()
-	go serial.GrTransmit()
-	go serial.GrRxPrase()
+	startSubscribe()
 	cases := casesT{
 		{
 			http.MethodGet,
@@ -54,6 +65,12 @@ func TestSerialCurCtrl(t *testing.T) {
 			struct{ Serial string }{Serial: "Test port"},
 			http.StatusOK,
 		},
+		{
+			http.MethodPost,
+			"/serial_cur",
+			struct{ Serial string }{Serial: "Test port"},
+			http.StatusInternalServerError,
+		},
 		{
 			http.MethodGet,
 			"/serial_cur",
@@ -66,6 +83,18 @@ func TestSerialCurCtrl(t *testing.T) {
 			struct{ Serial string }{Serial: "Test port"},
 			http.StatusMethodNotAllowed,
 		},
+		{
+			http.MethodDelete,
+			"/serial_cur",
+			struct{ Serial string }{Serial: "Test port"},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodDelete,
+			"/serial_cur",
+			struct{ Serial string }{Serial: "Test port"},
+			http.StatusInternalServerError,
+		},
 		{
 			http.MethodDelete,
 			"/serial_cur",
@@ -75,3 +104,283 @@ func TestSerialCurCtrl(t *testing.T) {
 	}
 	ctrlerTest(serialCurCtrl, cases, t)
 }
+
+func TestSerialCurNetwork(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := "tcp://" + l.Addr().String()
+
+	cases := casesT{
+		{
+			http.MethodPost,
+			"/serial_cur",
+			struct{ Serial string }{Serial: addr},
+			http.StatusOK,
+		},
+		{
+			http.MethodPost,
+			"/serial_cur",
+			struct{ Serial string }{Serial: "udp://127.0.0.1"},
+			http.StatusInternalServerError,
+		},
+		{
+			http.MethodDelete,
+			"/serial_cur",
+			struct{ Serial string }{Serial: addr},
+			http.StatusNoContent,
+		},
+	}
+	ctrlerTest(serialCurCtrl, cases, t)
+}
+
+func TestSerialCurCloseReconnecting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "tcp://" + l.Addr().String()
+	serial.CloseAll()
+	if err := serial.Open(addr, 115200, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	// 板子那头断开，也不再接受连接，串口进入重连
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	l.Close()
+	for i := 0; ; i++ {
+		if s := serial.List(); len(s) == 1 && s[0].State == serial.PortReconnecting {
+			break
+		}
+		if i > 50 {
+			t.Fatalf("not reconnecting: %+v", serial.List())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 重连中的串口已经关过了，再关不该出错，路由也要清掉
+	if code, body := serve(serialCurCtrl, http.MethodDelete, "/serial_cur", struct{ Serial string }{addr}); code != http.StatusNoContent {
+		t.Errorf("DELETE: %d %s", code, body)
+	}
+	if s := serial.List(); len(s) != 0 {
+		t.Errorf("still open: %+v", s)
+	}
+}
+
+func TestSerialCurUDPBatch(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	addr := "udp://" + conn.LocalAddr().String()
+	serial.CloseAll()
+	if err := serial.Open(addr, 115200); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	// 板子先收到一个请求，才知道回给谁
+	if err := serial.SendCmd(variable.Read, variable.CmdT{Board: 1, Length: 4, Addr: 0x20000000}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, peer, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 个最宽的值装进一帧，整个数据报远超 400 字节
+	l := []protocol.Response{}
+	for i := 0; i < 10; i++ {
+		wide := make([]byte, protocol.MaxValueLen)
+		wide[0] = 0xC0 // 要转义的字节
+		l = append(l, protocol.Response{Board: 1, Act: protocol.SubscribeReturn, Addr: 0x20000000 + uint32(i)*0x40,
+			Length: protocol.MaxValueLen, Wide: wide})
+	}
+	frame := protocol.PackBatch(1, 100, 1, l)
+	if len(frame) <= 702 || len(frame) > protocol.MaxBatchFrameLen {
+		t.Fatalf("frame length %d", len(frame))
+	}
+	if _, err := conn.WriteTo(frame, peer); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	s := serial.List()
+	if len(s) != 1 || s[0].Link.Frames != 1 || s[0].Link.CRCErrors != 0 || s[0].Link.BadFrames != 0 {
+		t.Errorf("link %+v", s)
+	}
+}
+
+func TestSerialCurProtocolV2(t *testing.T) {
+	serial.SetOptProtocolV2(true)
+	defer serial.SetOptProtocolV2(false)
+	serial.CloseAll()
+	if err := serial.Open("Test port", 115200); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	time.Sleep(100 * time.Millisecond) // 等待握手
+	if _, err := serial.ReadValue(variable.CmdT{Board: 1, Length: 4, Addr: 0x20000000}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	l := serial.List()
+	if len(l) != 1 || l[0].Link.Version != 2 || !l[0].Link.Batch || l[0].Link.Frames == 0 || l[0].Link.CRCErrors != 0 {
+		t.Errorf("link %+v", l)
+	}
+
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/serial_cur",
+			nil,
+			http.StatusOK,
+		},
+	}
+	ctrlerTest(serialCurCtrl, cases, t)
+}
+
+func TestBoardsCtrl(t *testing.T) {
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/boards",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodPost,
+			"/boards",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(boardsCtrl, cases, t)
+}
+
+func TestSerialCurV2PerBoard(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	addr := "udp://" + conn.LocalAddr().String()
+	serial.SetOptProtocolV2(true)
+	defer serial.SetOptProtocolV2(false)
+	serial.CloseAll()
+	if err := serial.Open(addr, 115200, 1, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+
+	// 板子 1 和 3 答应 v2，板子 2 只懂 v1，对握手沉默
+	buf := make([]byte, 64)
+	var peer net.Addr
+	for i := 0; i < 3; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer = from
+		r, err := protocol.DecodeRequest(buf[:n])
+		if err != nil || r.Act != protocol.Hello {
+			t.Fatalf("hello %d: %v %+v", i, err, r)
+		}
+		if r.Board == 2 {
+			continue
+		}
+		rep := protocol.Response{Board: r.Board, Act: protocol.HelloReturn}
+		rep.Data[0] = protocol.V2
+		rep.Data[1] = protocol.CapBatch
+		if _, err := conn.WriteTo(rep.Pack(), peer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, b := range []uint8{1, 2, 3} {
+		if err := serial.SendCmd(variable.Read, variable.CmdT{Board: b, Length: 4, Addr: 0x20000000}); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := protocol.RequestV2Len
+		if b == 2 {
+			want = protocol.RequestLen
+		}
+		if n != want {
+			t.Errorf("board %d request length %d, want %d", b, n, want)
+		}
+	}
+
+	// 每块单片机各自编号，交错到达也不算丢帧
+	for _, seq := range []uint8{5, 6, 7} {
+		for _, b := range []uint8{1, 3} {
+			r := protocol.Response{Board: b, Act: protocol.ReadReturn, Length: 4, Addr: 0x20000000}
+			if _, err := conn.WriteTo(r.PackV2(seq), peer); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	l := serial.List()
+	if len(l) != 1 {
+		t.Fatalf("list %+v", l)
+	}
+	s := l[0].Link
+	if s.Version != 2 || !s.Batch || len(s.V2Boards) != 2 || s.V2Boards[0] != 1 || s.V2Boards[1] != 3 {
+		t.Errorf("link %+v", s)
+	}
+	if s.Frames < 6 || s.SeqGaps != 0 || s.CRCErrors != 0 || s.BadFrames != 0 {
+		t.Errorf("link %+v", s)
+	}
+}
+
+func TestSerialCurNoBatch(t *testing.T) {
+	startSubscribe()
+	serial.CloseAll()
+	if err := serial.Open("Test port", 115200); err != nil { // 没开 v2，没有批量帧
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+	for len(serial.ChStatus) != 0 {
+		<-serial.ChStatus
+	}
+
+	imu := variable.T{Board: 1, Name: "imu", Type: "struct IMU", Addr: 0x20000060, Fields: []variable.FieldT{
+		{Name: "x", Offset: 0, Type: "float"},
+		{Name: "y", Offset: 4, Type: "float"},
+		{Name: "z", Offset: 8, Type: "float"},
+	}}
+	variable.UseAll(variable.RD, map[variable.Key]variable.T{variable.KeyOf(imu): imu})
+	defer variable.UseAll(variable.RD, map[variable.Key]variable.T{})
+
+	// 每次重新订阅都订不上，前端只听一次，也不是单片机的错误
+	time.Sleep(time.Second)
+	l := []serial.StatusT{}
+	for len(serial.ChStatus) != 0 {
+		var s serial.StatusT
+		if err := json.Unmarshal([]byte(<-serial.ChStatus), &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Addr == imu.Addr {
+			l = append(l, s)
+		}
+	}
+	if len(l) != 1 || l[0].Code != 0 || l[0].Act != variable.Subscribe || l[0].Error != serial.ErrNoBatch.Error() {
+		t.Errorf("status %+v", l)
+	}
+}
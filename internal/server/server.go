@@ -11,6 +11,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/scutrobotlab/asuwave/internal/helper"
+	"github.com/scutrobotlab/asuwave/internal/serial"
 	"github.com/scutrobotlab/asuwave/internal/variable"
 )
 
@@ -27,6 +28,9 @@ func Start(fsys *fs.FS) {
 	}
 	fmt.Println("Don't close this before you have done")
 
+	go dataHub.Run(serial.Chch)
+	go statusHub.Run(serial.ChStatus)
+
 	variableToReadCtrl := makeVariableCtrl(variable.RD)
 	variableToWriteCtrl := makeVariableCtrl(variable.WR)
 	//为.js扩展名添加MIME类型，这样服务器可以正确地提供JavaScript文件。
@@ -37,15 +41,28 @@ func Start(fsys *fs.FS) {
 	//设置不同的HTTP路由和对应的控制器
 	http.Handle("/serial", logs(serialCtrl))
 	http.Handle("/serial_cur", logs(serialCurCtrl))
+	http.Handle("/boards", logs(boardsCtrl))
 	http.Handle("/variable_read", logs(variableToReadCtrl))
 	http.Handle("/variable_write", logs(variableToWriteCtrl))
+	http.Handle("/variable_read/value", logs(variableValueCtrl))
+	http.Handle("/subscription", logs(subscriptionCtrl))
 	http.Handle("/variable_proj", logs(variableToProjCtrl))
+	http.Handle("/variable_proj/search", logs(variableProjSearchCtrl))
+	http.Handle("/variable_proj/tree", logs(variableProjTreeCtrl))
 	http.Handle("/variable_type", logs(variableTypeCtrl))
 	http.Handle("/file/upload", logs(fileUploadCtrl))
 	http.Handle("/file/path", logs(filePathCtrl))
+	http.Handle("/file/target", logs(fileTargetCtrl))
+	http.Handle("/file/memory", logs(fileMemoryCtrl))
 	http.Handle("/option", logs(optionCtrl))
-	http.Handle("/dataws", logs(dataWebsocketCtrl))
+	http.Handle("/project", logs(projectCtrl))
+	http.Handle("/record", logs(recordCtrl))
+	http.Handle("/record/replay", logs(replayCtrl))
+	http.Handle("/export", logs(exportCtrl))
+	http.Handle("/dataws", logs(makeHubWebsocketCtrl(dataHub)))
+	http.Handle("/dataws/stat", logs(dataWebsocketStatCtrl))
 	http.Handle("/filews", logs(fileWebsocketCtrl))
+	http.Handle("/statusws", logs(makeHubWebsocketCtrl(statusHub)))
 	//启动HTTP服务器并监听之前定义的端口.如果出现错误，则打印错误日志并结束程序。
 	glog.Fatalln(http.ListenAndServe(port, nil))
 }
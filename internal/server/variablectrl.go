@@ -2,12 +2,19 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/scutrobotlab/asuwave/internal/option"
 	"github.com/scutrobotlab/asuwave/internal/serial"
 	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/elffile"
 )
 
 // makeVariableCtrl 接受一个 variable.Mod 类型参数，并返回一个用于控制变量的HTTP处理函数。
@@ -41,21 +48,43 @@ func makeVariableCtrl(m variable.Mod) func(w http.ResponseWriter, r *http.Reques
 				io.WriteString(w, errorJson("Invaild json"))
 				return
 			}
-			// 验证地址的有效性。
-			if newVariable.Addr >= 0x80000000 {
+			// 未指定板子时，默认为板子1。
+			if newVariable.Board == 0 {
+				newVariable.Board = variable.Board1
+			}
+			// 结构体的成员、枚举的取值和位域的位置，从工程变量中找来。
+			if p, ok := variable.GetProj(newVariable.Board, newVariable.Name); ok && len(newVariable.Fields) == 0 && p.Type == newVariable.Type {
+				p.Apply(&newVariable)
+			}
+			if len(newVariable.Fields) != 0 && m == variable.WR {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Struct snapshot is read only"))
+				return
+			}
+			if newVariable.Len() > variable.MaxLen {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Variable too long"))
+				return
+			}
+			// 验证地址的有效性，须落在工程文件的内存区域中。
+			if _, err := checkAddr(newVariable); err != nil {
 				w.WriteHeader(http.StatusBadRequest)
 				io.WriteString(w, errorJson("Address out of range"))
 				return
 			}
-			// 检查地址是否已经被使用。
-			if _, ok := variable.Get(m, newVariable.Addr); ok {
+			// 经由指针的变量，读出指针才知道它在哪里，先存下，由定时读指针时订阅。
+			if newVariable.Ptr != nil {
+				newVariable.Addr = 0
+			}
+			// 检查该板子上的地址是否已经被使用。
+			if _, ok := variable.Get(m, variable.KeyOf(newVariable)); ok {
 				w.WriteHeader(http.StatusBadRequest)
 				io.WriteString(w, errorJson("Address already used"))
 				return
 			}
 			// 设置新变量。
 			// 发送读命令。
-			variable.Set(m, newVariable.Addr, newVariable)
+			variable.Set(m, variable.KeyOf(newVariable), newVariable)
 			w.WriteHeader(http.StatusNoContent) // 返回204 No Content响应。
 			io.WriteString(w, "")
 
@@ -76,20 +105,54 @@ func makeVariableCtrl(m variable.Mod) func(w http.ResponseWriter, r *http.Reques
 				io.WriteString(w, errorJson("Invaild json"))
 				return
 			}
+			if modVariable.Board == 0 {
+				modVariable.Board = variable.Board1
+			}
+			// 前端只带来名字、类型、地址和值，位域的位置、枚举和指针从添加时存下的变量中找，
+			// 不然写入整个存储单元，把旁边的位域也改了；指针或许已指向别处，写之前要再读一次。
+			if v, ok := variable.Find(variable.WR, modVariable); ok {
+				modVariable.Type = v.Type
+				modVariable.Enum = v.Enum
+				modVariable.BitOffset = v.BitOffset
+				modVariable.BitSize = v.BitSize
+				modVariable.Ptr = v.Ptr
+			} else if p, ok := variable.GetProj(modVariable.Board, modVariable.Name); ok && p.Type == modVariable.Type {
+				p.Apply(&modVariable)
+			}
 			// 检查串口是否打开。
-			if serial.SerialCur.Name == "" {
+			if !serial.IsOpen() {
 				w.WriteHeader(http.StatusInternalServerError)
 				io.WriteString(w, "Not allow when serial port closed.") // 如果串口是关闭的，则返回500 Internal Server Error。
 				return
 			}
 			// 发送写命令。
-			err = serial.SendWriteCmd(modVariable)
+			done, err := serial.SendWriteCmd(modVariable)
 			if err != nil {
 				// 如果写命令失败，则返回500 Internal Server Error。
 				w.WriteHeader(http.StatusInternalServerError)
 				io.WriteString(w, errorJson(err.Error()))
 				return
 			}
+			// 指定 wait 时，等到单片机确认修改再返回。
+			if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+				err = <-done
+				var mcuErr *variable.MCUError
+				if err == serial.ErrTimeout {
+					// 重发后仍未确认，返回504 Gateway Timeout。
+					w.WriteHeader(http.StatusGatewayTimeout)
+					io.WriteString(w, errorJson(err.Error()))
+					return
+				} else if errors.As(err, &mcuErr) {
+					// 单片机拒绝修改，返回502 Bad Gateway。
+					w.WriteHeader(http.StatusBadGateway)
+					io.WriteString(w, errorJson(err.Error()))
+					return
+				} else if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					io.WriteString(w, errorJson(err.Error()))
+					return
+				}
+			}
 			w.WriteHeader(http.StatusNoContent) // 返回204 No Content响应。
 			io.WriteString(w, "")
 		// 删除变量
@@ -109,7 +172,14 @@ func makeVariableCtrl(m variable.Mod) func(w http.ResponseWriter, r *http.Reques
 			// 	io.WriteString(w, errorJson("No such address"))
 			// }
 
-			variable.Delete(m, oldVariable.Addr)
+			if oldVariable.Board == 0 {
+				oldVariable.Board = variable.Board1
+			}
+			// 同一处可能有好几个位域，找出前端说的那一个。
+			if v, ok := variable.Find(m, oldVariable); ok {
+				oldVariable = v
+			}
+			variable.Delete(m, variable.KeyOf(oldVariable))
 			w.WriteHeader(http.StatusNoContent) // 返回204 No Content响应，表示请求已成功处理，但没有内容返回。
 			io.WriteString(w, "")
 			return // 结束此case，返回。
@@ -121,16 +191,147 @@ func makeVariableCtrl(m variable.Mod) func(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// 单次读取的超时时间
+const readTimeout = time.Second
+
+// 读取一次变量的值，不必订阅
+// 以 name 指定工程变量或已添加的变量，或以 addr、type、board 直接指定
+func variableValueCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		board, err := queryBoard(q, variable.Board1)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		v := variable.T{Board: board}
+		if name := q.Get("name"); name != "" {
+			if p, ok := variable.GetProj(board, name); ok {
+				addr, err := strconv.ParseUint(p.Addr, 0, 32)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					io.WriteString(w, errorJson(err.Error()))
+					return
+				}
+				v.Name = p.Name
+				v.Type = p.Type
+				v.Addr = uint32(addr)
+				p.Apply(&v)
+			} else if t, ok := variable.GetByName(variable.RD, name); ok {
+				v = t
+			} else if t, ok := variable.GetByName(variable.WR, name); ok {
+				v = t
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("No such variable: "+name))
+				return
+			}
+		} else {
+			addr, err := strconv.ParseUint(q.Get("addr"), 0, 32)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, errorJson("Invaild addr"))
+				return
+			}
+			v.Addr = uint32(addr)
+			v.Type = q.Get("type")
+		}
+		if q.Has("board") {
+			v.Board = board // 已添加的变量也可以换一块板子读
+		}
+		if _, ok := variable.TypeLen[v.Type]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson("Invaild type"))
+			return
+		}
+		if _, err := checkReadAddr(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson("Address out of range"))
+			return
+		}
+		if v.Ptr != nil {
+			addr, err := serial.Deref(v, readTimeout)
+			if err != nil {
+				w.WriteHeader(readErrorStatus(err))
+				io.WriteString(w, errorJson(err.Error()))
+				return
+			}
+			v.Addr = addr
+		}
+
+		ret, err := serial.ReadValue(variable.CmdT{
+			Board:  v.Board,
+			Length: variable.TypeLen[v.Type],
+			Addr:   v.Addr,
+		}, readTimeout)
+		if err != nil {
+			w.WriteHeader(readErrorStatus(err))
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		v.Data = v.Value(ret.Data)
+		v.Tick = ret.Tick
+		b, _ := json.Marshal(v)
+		io.WriteString(w, string(b))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// 订阅的状况，用于排查通信问题
+func subscriptionCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		b, _ := json.Marshal(variable.GetSubs())
+		io.WriteString(w, string(b))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
 // 工程变量
 func variableToProjCtrl(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case http.MethodGet:
-		b, _ := variable.GetAllProj()
+		board, err := queryBoard(r.URL.Query(), variable.AllBoards)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		b, _ := variable.GetAllProj(board)
 		io.WriteString(w, string(b))
 	case http.MethodDelete:
-		variable.SetAllProj(variable.Projs{})
+		q := r.URL.Query()
+		board, err := queryBoard(q, variable.AllBoards)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		// 工程变量来自工程文件，连同它的内存区域与监视一起卸下
+		if q.Has("board") {
+			err = elffile.Unload(board)
+		} else {
+			err = elffile.UnloadAll()
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		option.SaveWatchList()
 
 		w.WriteHeader(http.StatusNoContent)
 		io.WriteString(w, "")
@@ -140,6 +341,111 @@ func variableToProjCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// 查找工程变量，免得一次拿走全部
+func variableProjSearchCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		board, err := queryBoard(q, variable.AllBoards)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		query := variable.QueryT{
+			Board: board,
+			Q:     q.Get("q"),
+			Mode:  q.Get("mode"),
+			Type:  q.Get("type"),
+		}
+		n, err := queryUints(q, "addr_min", "addr_max", "offset", "limit")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		query.AddrMin, query.AddrMax = uint32(n[0]), uint32(n[1])
+		query.Offset, query.Limit = int(n[2]), int(n[3])
+
+		ret, err := variable.SearchProj(query)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		b, _ := json.Marshal(ret)
+		io.WriteString(w, string(b))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// 工程变量的树，一次只展开一层
+func variableProjTreeCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		board, err := queryBoard(q, variable.AllBoards)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		n, err := queryUints(q, "offset", "limit")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, errorJson(err.Error()))
+			return
+		}
+		b, _ := json.Marshal(variable.ProjChildren(board, q.Get("parent"), int(n[0]), int(n[1])))
+		io.WriteString(w, string(b))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
+// queryUints 读出URL参数中的非负整数，没有的为 0
+func queryUints(q url.Values, names ...string) ([]uint64, error) {
+	l := make([]uint64, len(names))
+	for i, name := range names {
+		s := q.Get(name)
+		if s == "" {
+			continue
+		}
+		bits := 31 // 页码须能放进 int
+		if strings.HasPrefix(name, "addr") {
+			bits = 32
+		}
+		x, err := strconv.ParseUint(s, 0, bits)
+		if err != nil {
+			return nil, errors.New("Invaild " + name)
+		}
+		l[i] = x
+	}
+	return l, nil
+}
+
+// queryBoard 读出URL参数中的电路板，没有时为 def
+func queryBoard(q url.Values, def uint8) (uint8, error) {
+	b := q.Get("board")
+	if b == "" {
+		return def, nil
+	}
+	board, err := strconv.ParseUint(b, 0, 8)
+	if err != nil {
+		return 0, errors.New("Invaild board")
+	}
+	return uint8(board), nil
+}
+
 func variableTypeCtrl(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	w.Header().Set("Content-Type", "application/json")
@@ -159,3 +465,34 @@ func variableTypeCtrl(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
 	}
 }
+
+// checkAddr 验证变量的地址，经由指针的变量验证指针本身，它所指的地方可以是外设
+func checkAddr(v variable.T) (elffile.RegionT, error) {
+	if v.Ptr != nil {
+		return elffile.CheckAddr(v.Board, uint64(v.Ptr.Addr), v.Ptr.Size)
+	}
+	return elffile.CheckAddr(v.Board, uint64(v.Addr), v.Len())
+}
+
+// checkReadAddr 同 checkAddr，只读一次的话 flash 中的常量也行
+func checkReadAddr(v variable.T) (elffile.RegionT, error) {
+	if v.Ptr != nil {
+		return elffile.CheckReadAddr(v.Board, uint64(v.Ptr.Addr), v.Ptr.Size)
+	}
+	return elffile.CheckReadAddr(v.Board, uint64(v.Addr), v.Len())
+}
+
+// readErrorStatus 读取失败时的状态码
+func readErrorStatus(err error) int {
+	var mcuErr *variable.MCUError
+	switch {
+	case err == serial.ErrTimeout:
+		return http.StatusGatewayTimeout
+	case errors.As(err, &mcuErr):
+		return http.StatusBadGateway
+	case err == serial.ErrNullPointer:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,10 +2,13 @@ package server
 
 import (
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/scutrobotlab/asuwave/internal/serial"
 	"github.com/scutrobotlab/asuwave/internal/variable"
+	"github.com/scutrobotlab/asuwave/pkg/elffile"
 )
 
 func TestVariableToReadCtrl(t *testing.T) {
@@ -32,6 +35,29 @@ func TestVariableToReadCtrl(t *testing.T) {
 			},
 			http.StatusNoContent,
 		},
+		{
+			http.MethodPost,
+			"/variable_read",
+			variable.T{
+				Board:  1,
+				Name:   "big",
+				Type:   "[20]double",
+				Addr:   0x20000000,
+				Fields: []variable.FieldT{{Name: "[19]", Offset: 152, Type: "double"}},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPost,
+			"/variable_read",
+			variable.T{
+				Board: 1,
+				Name:  "far",
+				Type:  "float",
+				Addr:  0x90000000,
+			},
+			http.StatusBadRequest,
+		},
 		{
 			http.MethodGet,
 			"/variable_read",
@@ -116,6 +142,42 @@ func TestVariableToWriteCtrl(t *testing.T) {
 			},
 			http.StatusNoContent,
 		},
+		{
+			http.MethodPut,
+			"/variable_write?wait=true",
+			struct {
+				Board uint8
+				Name  string
+				Type  string
+				Addr  uint32
+				Data  float64
+			}{
+				Board: 1,
+				Name:  "a",
+				Type:  "double",
+				Addr:  0x20123456,
+				Data:  200,
+			},
+			http.StatusNoContent,
+		},
+		{
+			http.MethodPut,
+			"/variable_write?wait=true",
+			struct {
+				Board uint8
+				Name  string
+				Type  string
+				Addr  uint32
+				Data  float64
+			}{
+				Board: 1,
+				Name:  "b",
+				Type:  "double",
+				Addr:  0x00123456,
+				Data:  200,
+			},
+			http.StatusBadGateway,
+		},
 		{
 			http.MethodDelete,
 			"/variable_write",
@@ -139,6 +201,265 @@ func TestVariableToWriteCtrl(t *testing.T) {
 	ctrlerTest(variableToWriteCtrl, cases, t)
 }
 
+func TestVariableWriteBits(t *testing.T) {
+	serial.CloseAll()
+	if err := serial.Open("Test port", 115200); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+	ctrl := makeVariableCtrl(variable.WR)
+
+	// 同一存储单元中的两个位域都能添加
+	for _, v := range []variable.T{
+		{Board: 1, Name: "f.a", Type: "unsigned int", Addr: 0x20000010, BitOffset: 0, BitSize: 3},
+		{Board: 1, Name: "f.b", Type: "unsigned int", Addr: 0x20000010, BitOffset: 3, BitSize: 5},
+	} {
+		if code, body := serve(ctrl, http.MethodPost, "/variable_write", v); code != http.StatusNoContent {
+			t.Fatalf("POST %s: %d %s", v.Name, code, body)
+		}
+	}
+
+	// 前端写入时不带位域的位置，旁边的位域也不该被改掉
+	type putT struct {
+		Board uint8
+		Name  string
+		Type  string
+		Addr  uint32
+		Data  float64
+	}
+	for _, v := range []putT{
+		{Board: 1, Name: "f.a", Type: "unsigned int", Addr: 0x20000010, Data: 5},
+		{Board: 1, Name: "f.b", Type: "unsigned int", Addr: 0x20000010, Data: 10},
+	} {
+		if code, body := serve(ctrl, http.MethodPut, "/variable_write?wait=true", v); code != http.StatusNoContent {
+			t.Fatalf("PUT %s: %d %s", v.Name, code, body)
+		}
+	}
+	r, err := serial.ReadValue(variable.CmdT{Board: 1, Length: 4, Addr: 0x20000010}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := variable.BytesToUint32(r.Data); x != 0x55 {
+		t.Errorf("unit = %#x, want 0x55", x)
+	}
+
+	for _, v := range []putT{
+		{Board: 1, Name: "f.a", Type: "unsigned int", Addr: 0x20000010},
+		{Board: 1, Name: "f.b", Type: "unsigned int", Addr: 0x20000010},
+	} {
+		if code, body := serve(ctrl, http.MethodDelete, "/variable_write", v); code != http.StatusNoContent {
+			t.Fatalf("DELETE %s: %d %s", v.Name, code, body)
+		}
+	}
+	if b, _ := variable.GetAll(variable.WR); strings.Contains(string(b), "f.") {
+		t.Errorf("not deleted: %s", b)
+	}
+}
+
+func TestVariableWritePointer(t *testing.T) {
+	serial.CloseAll()
+	if err := serial.Open("Test port", 115200); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+	ctrl := makeVariableCtrl(variable.WR)
+
+	// 指针 p 在 0x20000030，先指向 0x20000040
+	point := func(addr uint32) {
+		done, err := serial.SendWriteCmd(variable.T{Board: 1, Name: "p", Type: "uint32_t", Addr: 0x20000030, Data: float64(addr)})
+		if err == nil {
+			err = <-done
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	point(0x20000040)
+	v := variable.T{Board: 1, Name: "p->a", Type: "uint32_t", Addr: 0x20000030, Ptr: &variable.PtrT{Addr: 0x20000030, Size: 4}}
+	if code, body := serve(ctrl, http.MethodPost, "/variable_write", v); code != http.StatusNoContent {
+		t.Fatalf("POST: %d %s", code, body)
+	}
+	// 指针在定时读出之前没有地址
+	defer serve(ctrl, http.MethodDelete, "/variable_write", variable.T{Board: 1, Name: "p->a"})
+
+	// 指针改指 0x20000050，前端不带 Ptr，也应当写到指针现在所指之处
+	point(0x20000050)
+	put := struct {
+		Board uint8
+		Name  string
+		Type  string
+		Addr  uint32
+		Data  float64
+	}{Board: 1, Name: "p->a", Type: "uint32_t", Data: 7}
+	if code, body := serve(ctrl, http.MethodPut, "/variable_write?wait=true", put); code != http.StatusNoContent {
+		t.Fatalf("PUT: %d %s", code, body)
+	}
+	r, err := serial.ReadValue(variable.CmdT{Board: 1, Length: 4, Addr: 0x20000050}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := variable.BytesToUint32(r.Data); x != 7 {
+		t.Errorf("*p = %d, want 7", x)
+	}
+}
+
+func TestVariablePointerUnresolved(t *testing.T) {
+	serial.CloseAll()
+	ctrl := makeVariableCtrl(variable.RD)
+	// 串口没开，读不出指针，也先存下，等指针指向某处再订阅
+	v := variable.T{Board: 1, Name: "q->speed", Type: "float", Ptr: &variable.PtrT{Addr: 0x20000500, Size: 4}}
+	if code, body := serve(ctrl, http.MethodPost, "/variable_read", v); code != http.StatusNoContent {
+		t.Fatalf("POST: %d %s", code, body)
+	}
+	defer serve(ctrl, http.MethodDelete, "/variable_read", v)
+	if _, body := serve(ctrl, http.MethodGet, "/variable_read", nil); !strings.Contains(body, `"1:*0x20000500+0":`) {
+		t.Errorf("GET: %s", body)
+	}
+	if _, add, _ := variable.Filt(nil); len(add) != 0 {
+		t.Errorf("subscribed before resolved: %v", add)
+	}
+}
+
+func TestVariableSnapshotFirstMember(t *testing.T) {
+	ctrl := makeVariableCtrl(variable.RD)
+	// 整块订阅的结构体与它的首个成员地址相同，两个都能添加
+	whole := variable.T{Board: 1, Name: "imu", Type: "struct IMU", Addr: 0x20000020, Fields: []variable.FieldT{
+		{Name: "x", Offset: 0, Type: "float"},
+		{Name: "y", Offset: 4, Type: "float"},
+	}}
+	first := variable.T{Board: 1, Name: "imu.x", Type: "float", Addr: 0x20000020}
+	for _, v := range []variable.T{whole, first} {
+		if code, body := serve(ctrl, http.MethodPost, "/variable_read", v); code != http.StatusNoContent {
+			t.Errorf("POST %s: %d %s", v.Name, code, body)
+		}
+	}
+	if code, _ := serve(ctrl, http.MethodPost, "/variable_read", first); code != http.StatusBadRequest {
+		t.Errorf("POST %s again: %d", first.Name, code)
+	}
+
+	// 前端删除时不带成员，也能找到
+	for _, v := range []variable.T{whole, first} {
+		v.Fields = nil
+		if code, body := serve(ctrl, http.MethodDelete, "/variable_read", v); code != http.StatusNoContent {
+			t.Errorf("DELETE %s: %d %s", v.Name, code, body)
+		}
+	}
+	if b, _ := variable.GetAll(variable.RD); strings.Contains(string(b), "imu") {
+		t.Errorf("not deleted: %s", b)
+	}
+}
+
+func TestVariableValueCtrl(t *testing.T) {
+	serial.CloseAll() // 重新打开，以免沿用上个测试的串口
+	serial.Open("Test port", 115200)
+	defer serial.CloseAll()
+	// 虚拟电路板上 0x20000500 处的指针是空的
+	variable.SetProj(variable.AllBoards, "q->speed", variable.ProjT{Name: "q->speed", Addr: "0x20000500", Type: "float",
+		Ptr: &variable.PtrT{Addr: 0x20000500, Size: 4}})
+	defer variable.DeleteProj(variable.AllBoards, "q->speed")
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/variable_read/value?name=q->speed",
+			nil,
+			http.StatusConflict,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?addr=0x40123456&type=float",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?addr=0x40123456&type=float&board=1",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?addr=0x00123456&type=float",
+			nil,
+			http.StatusBadGateway,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?addr=0x40123456&type=float&board=4",
+			nil,
+			http.StatusBadGateway,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?addr=0x90000000&type=float",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?addr=0x40123456&type=struct",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodGet,
+			"/variable_read/value?name=unfound",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPost,
+			"/variable_read/value",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(variableValueCtrl, cases, t)
+}
+
+func TestVariableValueReadOnly(t *testing.T) {
+	serial.CloseAll()
+	if err := serial.Open("Test port", 115200); err != nil {
+		t.Fatal(err)
+	}
+	defer serial.CloseAll()
+	// 板子 1 的常量放在 .rodata，读得到却写不了
+	elffile.SetMemoryMap(variable.Board1, elffile.Regions{{Name: ".bss", Start: 0x20000000, End: 0x20000100}})
+	elffile.SetReadableMap(variable.Board1, elffile.Regions{
+		{Name: ".rodata", Start: 0x20000800, End: 0x20000900},
+		{Name: ".bss", Start: 0x20000000, End: 0x20000100},
+	})
+	defer elffile.Unload(variable.Board1)
+
+	if code, body := serve(variableValueCtrl, http.MethodGet, "/variable_read/value?addr=0x20000800&type=uint32_t", nil); code != http.StatusOK {
+		t.Errorf("GET const: %d %s", code, body)
+	}
+	if code, body := serve(variableValueCtrl, http.MethodGet, "/variable_read/value?addr=0x200000fe&type=uint32_t", nil); code != http.StatusBadRequest {
+		t.Errorf("GET across the end: %d %s", code, body)
+	}
+	v := variable.T{Board: 1, Name: "version", Type: "uint32_t", Addr: 0x20000800}
+	if code, body := serve(makeVariableCtrl(variable.WR), http.MethodPost, "/variable_write", v); code != http.StatusBadRequest {
+		t.Errorf("POST const to write: %d %s", code, body)
+	}
+}
+
+func TestSubscriptionCtrl(t *testing.T) {
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/subscription",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodPost,
+			"/subscription",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(subscriptionCtrl, cases, t)
+}
+
 func TestVariableTypeCtrl(t *testing.T) {
 	cases := casesT{
 		{
@@ -157,3 +478,69 @@ func TestVariableTypeCtrl(t *testing.T) {
 
 	ctrlerTest(variableTypeCtrl, cases, t)
 }
+
+func TestVariableProjSearchCtrl(t *testing.T) {
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/variable_proj/search?q=speed&mode=fuzzy&type=float&addr_min=0x20000000&addr_max=0x3fffffff&offset=0&limit=20",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/variable_proj/search?q=(&mode=regex",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodGet,
+			"/variable_proj/search?mode=glob",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodGet,
+			"/variable_proj/search?limit=-1",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodPost,
+			"/variable_proj/search",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(variableProjSearchCtrl, cases, t)
+}
+
+func TestVariableProjTreeCtrl(t *testing.T) {
+	cases := casesT{
+		{
+			http.MethodGet,
+			"/variable_proj/tree",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/variable_proj/tree?parent=g_chassis&offset=10&limit=10",
+			nil,
+			http.StatusOK,
+		},
+		{
+			http.MethodGet,
+			"/variable_proj/tree?offset=x",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			http.MethodDelete,
+			"/variable_proj/tree",
+			nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+	ctrlerTest(variableProjTreeCtrl, cases, t)
+}
@@ -1,16 +1,23 @@
 package server
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 
 	"github.com/golang/glog"
 	"github.com/gorilla/websocket"
-
-	"github.com/scutrobotlab/asuwave/internal/serial"
 	"github.com/scutrobotlab/asuwave/pkg/elffile"
 )
 
-func dataWebsocketCtrl(w http.ResponseWriter, r *http.Request) {
+// makeHubWebsocketCtrl 返回一个把 h 中的消息推送给客户端的 websocket 处理函数
+func makeHubWebsocketCtrl(h *hub) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hubWebsocket(h, w, r)
+	}
+}
+
+func hubWebsocket(h *hub, w http.ResponseWriter, r *http.Request) {
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
@@ -24,16 +31,49 @@ func dataWebsocketCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer c.Close()
+
+	client := h.Subscribe(r.RemoteAddr)
+	defer h.Unsubscribe(client)
+
+	// 客户端断开时，读取会出错
+	closed := make(chan bool)
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
 	for {
-		b := <-serial.Chch
-		err = c.WriteMessage(websocket.TextMessage, []byte(b))
-		if err != nil {
-			glog.Errorln("write:", err)
-			break
+		select {
+		case b := <-client.queue:
+			err = c.WriteMessage(websocket.TextMessage, []byte(b))
+			if err != nil {
+				glog.Errorln("write:", err)
+				return
+			}
+		case <-closed:
+			return
 		}
 	}
 }
 
+// 查看每个图表客户端的积压与丢弃情况
+func dataWebsocketStatCtrl(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		b, _ := json.Marshal(dataHub.Stats())
+		io.WriteString(w, string(b))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, errorJson(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
+
 func fileWebsocketCtrl(w http.ResponseWriter, r *http.Request) {
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
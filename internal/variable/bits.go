@@ -0,0 +1,89 @@
+package variable
+
+// EnumT 是枚举的一个取值
+type EnumT struct {
+	Name  string
+	Value int64
+}
+
+// 有符号的整数类型，位域取出后要补上符号位；ARM 上 char 无符号
+var signedType = map[string]bool{
+	"int8_t":        true,
+	"int16_t":       true,
+	"int32_t":       true,
+	"int64_t":       true,
+	"int":           true,
+	"signed char":   true,
+	"short":         true,
+	"short int":     true,
+	"long":          true,
+	"long int":      true,
+	"long long":     true,
+	"long long int": true,
+}
+
+// BitsFromBytes 从小端的存储单元中取出位域，off 从最低位数起
+func BitsFromBytes(vType string, data []byte, off, size int) float64 {
+	raw := BytesToUint64(pad(data)) >> uint(off)
+	if size < 64 {
+		raw &= 1<<uint(size) - 1
+	}
+	if signedType[vType] && size < 64 && raw&(1<<uint(size-1)) != 0 {
+		return float64(int64(raw | ^uint64(0)<<uint(size)))
+	}
+	return float64(raw)
+}
+
+// BitsToBytes 把值改写进存储单元 cur 中的位域，其余的位保持原样
+func BitsToBytes(vType string, cur []byte, off, size int, i float64) []byte {
+	n := TypeLen[vType]
+	mask := ^uint64(0)
+	if size < 64 {
+		mask = 1<<uint(size) - 1
+	}
+	var x uint64
+	if signedType[vType] {
+		x = uint64(int64(i))
+	} else {
+		x = uint64(i)
+	}
+	raw := BytesToUint64(pad(cur))
+	raw = raw&^(mask<<uint(off)) | (x&mask)<<uint(off)
+	return AnyToBytes(raw)[:n]
+}
+
+// pad 不足 8 字节的补零，免得读不出来
+func pad(data []byte) []byte {
+	if len(data) >= 8 {
+		return data
+	}
+	b := make([]byte, 8)
+	copy(b, data)
+	return b
+}
+
+// decode 按类型解出一个值，位域要先取出来
+func decode(vType string, data []byte, off, size int) float64 {
+	if size != 0 {
+		if len(data) > TypeLen[vType] {
+			data = data[:TypeLen[vType]]
+		}
+		return BitsFromBytes(vType, data, off, size)
+	}
+	return SpecFromBytes(vType, data)
+}
+
+// Value 从收到的数据解出变量的值
+func (v T) Value(data []byte) float64 {
+	return decode(v.Type, data, v.BitOffset, v.BitSize)
+}
+
+// EnumName 枚举取值的名字
+func (v T) EnumName(x float64) (string, bool) {
+	for _, e := range v.Enum {
+		if float64(e.Value) == x {
+			return e.Name, true
+		}
+	}
+	return "", false
+}
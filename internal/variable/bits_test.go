@@ -0,0 +1,91 @@
+package variable
+
+import "testing"
+
+func TestBits(t *testing.T) {
+	// struct { unsigned a:3; int b:5; unsigned d:20; }，a=5, b=-3, d=0x12345
+	word := uint32(5) | uint32(0x1d)<<3 | uint32(0x12345)<<10
+	data := AnyToBytes(word)
+	cases := []struct {
+		vType     string
+		off, size int
+		want      float64
+	}{
+		{"unsigned int", 0, 3, 5},
+		{"int", 3, 5, -3},
+		{"unsigned int", 10, 20, 0x12345},
+	}
+	for _, c := range cases {
+		if got := BitsFromBytes(c.vType, data, c.off, c.size); got != c.want {
+			t.Errorf("BitsFromBytes(%s, %d, %d) = %g, want %g", c.vType, c.off, c.size, got, c.want)
+		}
+	}
+
+	// 改写一个位域，其余的位不动
+	b := BitsToBytes("int", data, 3, 5, 7)
+	if len(b) != 4 || BitsFromBytes("int", b, 3, 5) != 7 ||
+		BitsFromBytes("unsigned int", b, 0, 3) != 5 || BitsFromBytes("unsigned int", b, 10, 20) != 0x12345 {
+		t.Errorf("BitsToBytes = %#v", b)
+	}
+
+	v := T{Type: "uint8_t", BitOffset: 1, BitSize: 2}
+	if got := v.Value([]byte{0x06, 0xff}); got != 3 {
+		t.Errorf("Value = %g, want 3", got)
+	}
+}
+
+func TestSpecFromBytesNames(t *testing.T) {
+	cases := []struct {
+		vType string
+		in    []byte
+		want  float64
+	}{
+		{"_Bool", []byte{2}, 1},
+		{"bool", []byte{0}, 0},
+		{"char", []byte{0xff}, 255},
+		{"signed char", []byte{0xff}, -1},
+		{"short int", []byte{0xfe, 0xff}, -2},
+		{"short unsigned int", []byte{0xfe, 0xff}, 65534},
+		{"long int", []byte{0xff, 0xff, 0xff, 0xff}, -1},
+	}
+	for _, c := range cases {
+		if got := SpecFromBytes(c.vType, c.in); got != c.want {
+			t.Errorf("SpecFromBytes(%s, %v) = %g, want %g", c.vType, c.in, got, c.want)
+		}
+		if n := TypeLen[c.vType]; n != len(c.in) {
+			t.Errorf("TypeLen[%s] = %d", c.vType, n)
+		}
+	}
+}
+
+func TestFiltBits(t *testing.T) {
+	// 同一存储单元的两个位域，只订阅一次，回音分给两个
+	a := T{Board: 1, Name: "f.a", Type: "unsigned int", Addr: 0x20000000, SignalGain: 1, BitOffset: 0, BitSize: 3}
+	b := T{Board: 1, Name: "f.b", Type: "unsigned int", Addr: 0x20000000, SignalGain: 1, BitOffset: 3, BitSize: 5}
+	to[RD].Lock()
+	old := to[RD].m
+	to[RD].m = map[Key]T{KeyOf(a): a, KeyOf(b): b}
+	to[RD].Unlock()
+	defer func() {
+		to[RD].Lock()
+		to[RD].m = old
+		to[RD].Unlock()
+	}()
+	ResetSubs()
+	defer ResetSubs()
+
+	_, add, _ := Filt(nil)
+	if len(add) != 1 || add[0].Length != 4 {
+		t.Fatalf("add %v", add)
+	}
+	SubSent(Subscribe, add[0])
+
+	chart, _, del := Filt([]CmdT{{Act: SubscribeReturn, Board: 1, Addr: 0x20000000, Length: 4, Data: []byte{0x55, 0, 0, 0, 0, 0, 0, 0}}})
+	got := map[string]float64{}
+	for _, c := range chart {
+		got[c.Name] = c.Data
+	}
+	if len(chart) != 2 || got["f.a"] != 5 || got["f.b"] != 10 || len(del) != 0 {
+		t.Errorf("chart %v del %v", chart, del)
+	}
+}
@@ -5,4 +5,5 @@ type ChartT struct {
 	Name  string
 	Data  float64
 	Tick  uint32
+	Port  string `json:",omitempty"` // 来自哪个串口
 }
@@ -3,10 +3,16 @@
 */
 package variable
 
+import "github.com/scutrobotlab/asuwave/pkg/protocol"
+
 // 篇幅有限，也挡不住我的思念
 const NumMaxPacket = 5
 
-type ActMode uint8
+// 一次能捎去的最长思念，结构体和数组整块订阅时也不能超过
+const MaxLen = protocol.MaxValueLen
+
+// 信的格式，约定在 protocol 里
+type ActMode = protocol.Act
 
 var TypeLen = map[string]int{
 	"uint8_t":  1,
@@ -20,18 +26,37 @@ var TypeLen = map[string]int{
 	"int":      4,
 	"float":    4,
 	"double":   8,
+
+	// C 语言的本名，长度按 32 位单片机
+	"bool":                   1,
+	"_Bool":                  1,
+	"char":                   1,
+	"signed char":            1,
+	"unsigned char":          1,
+	"short":                  2,
+	"short int":              2,
+	"unsigned short":         2,
+	"short unsigned int":     2,
+	"unsigned int":           4,
+	"long":                   4,
+	"long int":               4,
+	"unsigned long":          4,
+	"long unsigned int":      4,
+	"long long":              8,
+	"long long int":          8,
+	"unsigned long long":     8,
+	"long long unsigned int": 8,
 }
 
 const (
-	_                 ActMode = iota
-	Subscribe                 // 想让你一直联系
-	SubscribeReturn           // 期待你认真回应
-	Unsubscribe               // 却担心打扰到你
-	UnsubscribeReturn         // 有回复就够了呢
-	Read                      // 你在想什么
-	ReadReturn                // 能告诉我吗
-	Write                     // 希望改变你的心意
-	WriteReturn               // 传达到了吗
+	Subscribe         = protocol.Subscribe         // 想让你一直联系
+	SubscribeReturn   = protocol.SubscribeReturn   // 期待你认真回应
+	Unsubscribe       = protocol.Unsubscribe       // 却担心打扰到你
+	UnsubscribeReturn = protocol.UnsubscribeReturn // 有回复就够了呢
+	Read              = protocol.Read              // 你在想什么
+	ReadReturn        = protocol.ReadReturn        // 能告诉我吗
+	Write             = protocol.Write             // 希望改变你的心意
+	WriteReturn       = protocol.WriteReturn       // 传达到了吗
 )
 
 // 你现在在哪里呢
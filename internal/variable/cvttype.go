@@ -14,21 +14,26 @@ func AnyToBytes(i interface{}) []byte {
 
 func SpecFromBytes(vType string, data []byte) float64 {
 	switch vType {
-	case "uint8_t":
+	case "bool", "_Bool":
+		if BytesToUint8(data) != 0 {
+			return 1
+		}
+		return 0
+	case "uint8_t", "unsigned char", "char":
 		return float64(BytesToUint8(data))
-	case "uint16_t":
+	case "uint16_t", "unsigned short", "short unsigned int":
 		return float64(BytesToUint16(data))
-	case "uint32_t":
+	case "uint32_t", "unsigned int", "unsigned long", "long unsigned int":
 		return float64(BytesToUint32(data))
-	case "uint64_t":
+	case "uint64_t", "unsigned long long", "long long unsigned int":
 		return float64(BytesToUint64(data))
-	case "int8_t":
+	case "int8_t", "signed char":
 		return float64(BytesToInt8(data))
-	case "int16_t":
+	case "int16_t", "short", "short int":
 		return float64(BytesToInt16(data))
-	case "int32_t", "int":
+	case "int32_t", "int", "long", "long int":
 		return float64(BytesToInt32(data))
-	case "int64_t":
+	case "int64_t", "long long", "long long int":
 		return float64(BytesToInt64(data))
 	case "float":
 		return float64(BytesToFloat32(data))
@@ -40,21 +45,26 @@ func SpecFromBytes(vType string, data []byte) float64 {
 }
 func SpecToBytes(vType string, i float64) []byte {
 	switch vType {
-	case "uint8_t":
+	case "bool", "_Bool":
+		if i != 0 {
+			return AnyToBytes(uint8(1))
+		}
+		return AnyToBytes(uint8(0))
+	case "uint8_t", "unsigned char", "char":
 		return AnyToBytes(uint8(i))
-	case "uint16_t":
+	case "uint16_t", "unsigned short", "short unsigned int":
 		return AnyToBytes(uint16(i))
-	case "uint32_t":
+	case "uint32_t", "unsigned int", "unsigned long", "long unsigned int":
 		return AnyToBytes(uint32(i))
-	case "uint64_t":
+	case "uint64_t", "unsigned long long", "long long unsigned int":
 		return AnyToBytes(uint64(i))
-	case "int8_t":
+	case "int8_t", "signed char":
 		return AnyToBytes(int8(i))
-	case "int16_t":
+	case "int16_t", "short", "short int":
 		return AnyToBytes(int16(i))
-	case "int32_t", "int":
+	case "int32_t", "int", "long", "long int":
 		return AnyToBytes(int32(i))
-	case "int64_t":
+	case "int64_t", "long long", "long long int":
 		return AnyToBytes(int64(i))
 	case "float":
 		return AnyToBytes(float32(i))
@@ -122,11 +132,9 @@ func BytesToUint64(i []byte) uint64 {
 }
 
 func BytesToFloat32(bytes []byte) float32 {
-	bits := binary.LittleEndian.Uint32(bytes)
-	return math.Float32frombits(bits)
+	return math.Float32frombits(BytesToUint32(bytes))
 }
 
 func BytesToFloat64(bytes []byte) float64 {
-	bits := binary.LittleEndian.Uint64(bytes)
-	return math.Float64frombits(bits)
+	return math.Float64frombits(BytesToUint64(bytes))
 }
@@ -1,41 +1,42 @@
 /**/
 package variable
 
+import "github.com/scutrobotlab/asuwave/pkg/protocol"
+
 // 把我的思念，化作一串珍珠送给你
 func MakeWriteCmd(v T) []byte {
-	// 拾起一颗颗珍珠
-	data := make([]byte, 16)
-
-	// 刻上你所在的城市和我的思念
-	data[0] = byte(v.Board)
-	data[1] = byte(Write)
-	data[2] = byte(TypeLen[v.Type])
-	copy(data[3:7], AnyToBytes(v.Addr))
+	return makeWriteCmd(v, SpecToBytes(v.Type, v.Data))
+}
 
-	copy(data[7:15], SpecToBytes(v.Type, v.Data))
+// 位域只占存储单元的几位，cur 是存储单元现在的样子，其余的位原样送回
+func MakeBitsWriteCmd(v T, cur []byte) []byte {
+	return makeWriteCmd(v, BitsToBytes(v.Type, cur, v.BitOffset, v.BitSize, v.Data))
+}
 
-	// 终于完成了
-	data[15] = '\n'
+func makeWriteCmd(v T, data []byte) []byte {
+	// 刻上你所在的城市和我的思念
+	r := protocol.Request{
+		Board:  v.Board,
+		Act:    Write,
+		Length: uint8(TypeLen[v.Type]),
+		Addr:   v.Addr,
+	}
+	copy(r.Data[:], data)
 
 	// 传达给你吧
-	return data
+	return r.Encode()
 }
 
 // 把我的思念，化作一串珍珠送给你
 func MakeCmd(act ActMode, v CmdT) []byte {
-
-	// 拾起一颗颗珍珠
-	data := make([]byte, 16)
-
 	// 刻上你所在的城市和我的思念
-	data[0] = byte(v.Board)
-	data[1] = byte(act)
-	data[2] = byte(v.Length)
-	copy(data[3:7], AnyToBytes(v.Addr))
-
-	// 终于完成了
-	data[15] = '\n'
+	r := protocol.Request{
+		Board:  v.Board,
+		Act:    act,
+		Length: uint8(v.Length),
+		Addr:   v.Addr,
+	}
 
 	// 传达给你吧
-	return data
+	return r.Encode()
 }
@@ -0,0 +1,53 @@
+package variable
+
+import (
+	"fmt"
+
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
+)
+
+// 单片机的错误回应，代号紧接在回应代号之后
+const (
+	NoSuchAddrReg = protocol.NoSuchAddrReg // 取消订阅未订阅的地址
+	FullAddr      = protocol.FullAddr      // 订阅变量已达上限
+	NoSuchDataNum = protocol.NoSuchDataNum // 不支持的数据长度
+	NoSuchAddr    = protocol.NoSuchAddr    // 不支持的地址
+	NoSuchAct     = protocol.NoSuchAct     // 不支持的请求代号
+	NoSuchBoard   = protocol.NoSuchBoard   // 不支持的单片机代号
+)
+
+var errText = map[ActMode]string{
+	NoSuchAddrReg: "unsubscribe an unsubscribed address",
+	FullAddr:      "subscription limit reached",
+	NoSuchDataNum: "unsupported data length",
+	NoSuchAddr:    "unsupported address",
+	NoSuchAct:     "unsupported act",
+	NoSuchBoard:   "unsupported board",
+}
+
+// IsError 判断回应是否为错误
+func IsError(act ActMode) bool {
+	return act.IsError()
+}
+
+// MCUError 是单片机返回的错误
+type MCUError struct {
+	Code ActMode // 错误代号
+	Act  ActMode // 引发错误的请求代号，未知时为0
+	Cmd  CmdT    // 错误回应中带回的板子、地址和长度
+}
+
+func (e *MCUError) Error() string {
+	return fmt.Sprintf("board %d, addr 0x%08x, act 0x%02x: %s (0x%02x)",
+		e.Cmd.Board, e.Cmd.Addr, uint8(e.Act), errText[e.Code], uint8(e.Code))
+}
+
+// Permanent 表示同样的请求再发也不会成功
+func (e *MCUError) Permanent() bool {
+	switch e.Code {
+	case NoSuchDataNum, NoSuchAddr, NoSuchAct, NoSuchBoard:
+		return true
+	default:
+		return false
+	}
+}
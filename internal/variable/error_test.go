@@ -0,0 +1,35 @@
+package variable
+
+import "testing"
+
+func TestMCUError(t *testing.T) {
+	cases := []struct {
+		code      ActMode
+		isError   bool
+		permanent bool
+	}{
+		{SubscribeReturn, false, false},
+		{WriteReturn, false, false},
+		{NoSuchAddrReg, true, false},
+		{FullAddr, true, false},
+		{NoSuchDataNum, true, true},
+		{NoSuchAddr, true, true},
+		{NoSuchAct, true, true},
+		{NoSuchBoard, true, true},
+	}
+	for _, c := range cases {
+		if got := IsError(c.code); got != c.isError {
+			t.Errorf("IsError(0x%02x) == %t, want %t", uint8(c.code), got, c.isError)
+		}
+		if !c.isError {
+			continue
+		}
+		e := &MCUError{Code: c.code, Act: Subscribe, Cmd: CmdT{Board: 1, Addr: 0x20000000}}
+		if got := e.Permanent(); got != c.permanent {
+			t.Errorf("Permanent(0x%02x) == %t, want %t", uint8(c.code), got, c.permanent)
+		}
+		if e.Error() == "" {
+			t.Errorf("empty error message")
+		}
+	}
+}
@@ -1,72 +1,28 @@
 package variable
 
 import (
-	"github.com/golang/glog"
-	"github.com/scutrobotlab/asuwave/pkg/slip"
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
 )
 
 type CmdT struct {
+	Act    ActMode
 	Board  uint8
 	Length int
 	Addr   uint32
 	Tick   uint32
-	Data   [8]byte
+	Data   []byte
 }
 
-// Unpack 在如山的信笺里，找寻变量的回音
-func Unpack(data []byte) ([]CmdT, []byte) {
-
-	// 分开信笺
-	ends := []int{}
-	for i, d := range data {
-		if d == slip.END {
-			ends = append(ends, i)
-		}
-	}
-
-	if len(ends) == 0 { // 若是无言
-		return []CmdT{}, []byte{}
-	}
-
-	vars := []CmdT{}
-
-	// 探寻每一封信
-	for i := 1; i < len(ends); i++ {
-		// 此信浅薄，难载深情
-		if ends[i]-ends[i-1] < 20 {
-			continue
-		}
-		// 解开此信
-		glog.Infoln(data[ends[i-1] : ends[i]+1])
-		pack, err := slip.Unpack(data[ends[i-1] : ends[i]+1])
-		if err != nil {
-			glog.Errorln(err.Error())
-			continue
-		}
-		glog.Infoln(pack)
-		// 非变量之回音，或无合法之落款，则弃之
-		if len(pack) != 20 || ActMode(pack[1]) != SubscribeReturn || pack[19] != '\n' {
-			glog.V(1).Infoln("Not Subscribereturn pack", pack)
-			continue
-		}
-		// 聆听变量的回音
-		v := CmdT{
-			Board:  pack[0],
-			Length: int(pack[2]),
-			Addr:   BytesToUint32(pack[3:7]),
-			Data:   *(*[8]byte)(pack[7:15]),
-			Tick:   BytesToUint32(pack[15:19]),
-		}
-		// 加入变量列表
-		vars = append(vars, v)
-	}
-	f := ends[len(ends)-1]               // 最后的结束，
-	newbuff := make([]byte, len(data)-f) // 也是新的开始。
-	if len(newbuff) == 0 {
-		return vars, newbuff
+// CmdOf 聆听变量的回音，也可能是别的回应
+func CmdOf(r protocol.Response) CmdT {
+	return CmdT{
+		Act:    r.Act,
+		Board:  r.Board,
+		Length: int(r.Length),
+		Addr:   r.Addr,
+		Data:   r.Value(),
+		Tick:   r.Tick,
 	}
-	copy(newbuff, data[f:]) // 留存残篇。
-	return vars, newbuff    // 变量的回音，仍有余音
 }
 
 // Filt 从茫茫 vars 中，寻找我所挂念的 to[RD] ，记录在列表 chart 中。
@@ -74,39 +30,69 @@ func Unpack(data []byte) ([]CmdT, []byte) {
 func Filt(vars []CmdT) (chart []ChartT, add []CmdT, del []CmdT) {
 	to[RD].RLock()
 	defer to[RD].RUnlock()
+	subs.Lock()
+	defer subs.Unlock()
 
 	chart = []ChartT{}
 	add = []CmdT{} // 有些变量，我难以忘记
 	del = []CmdT{} // 有些变量，我不愿提起
 
-	addrs := map[uint32]bool{}
+	t := now()
+
+	// 同一个存储单元里或许住着好几个变量，一声回音，它们都听得见
+	units := map[Key][]T{}
+	for k, r := range to[RD].m {
+		if r.Unresolved() {
+			continue // 指针还是空的，等它指向某处再说
+		}
+		units[k.unit()] = append(units[k.unit()], r)
+	}
 
 	for _, v := range vars {
 		// 它是我要找的那个变量吗？
-		if r, ok := to[RD].m[v.Addr]; ok { // 是的，我还挂念着它
-			r.Tick = v.Tick
-			r.Data = SpecFromBytes(r.Type, v.Data[:])
-			chart = append(chart, ChartT{
-				Board: r.Board,
-				Name:  r.Name,
-				Data:  r.SignalGain*r.Data + r.SignalBias,
-				Tick:  r.Tick,
-			})
-		} else { // 不是的，请忘了它
+		if l, ok := units[subKeyOf(v)]; ok { // 是的，我还挂念着它
+			subSeen(v, true, t)
+			for _, r := range l {
+				r.Tick = v.Tick
+				if len(r.Fields) != 0 {
+					// 整块的思念，一笔一笔地拆开
+					chart = append(chart, r.snapshot(v.Data)...)
+					continue
+				}
+				r.Data = r.Value(v.Data)
+				chart = append(chart, ChartT{
+					Board: r.Board,
+					Name:  r.Name,
+					Data:  r.SignalGain*r.Data + r.SignalBias,
+					Tick:  r.Tick,
+				})
+			}
+		} else if subSeen(v, false, t) { // 不是的，请忘了它
 			del = append(del, v)
 		}
 	}
 
-	// 我所挂念的，它们都还在吗
-	for _, r := range to[RD].m {
-		if _, ok := addrs[r.Addr]; !ok {
+	// 我所挂念的，它们都还在吗；同住一处的，按最长的订阅
+	for k, l := range units {
+		c := CmdT{
+			Board: k.Board,
+			Addr:  k.Addr,
+		}
+		for _, r := range l {
+			if n := r.Len(); n > c.Length {
+				c.Length = n
+			}
+		}
+		if subNeeded(c, t) {
 			// 我很想它，下次请别忘记
-			add = append(add, CmdT{
-				Board:  r.Board,
-				Length: TypeLen[r.Type],
-				Addr:   r.Addr,
-			})
+			add = append(add, c)
 		}
 	}
+
+	// 那些早已远去的，就放下吧
+	subPrune(func(k Key) bool {
+		_, ok := units[k]
+		return ok
+	}, t)
 	return
 }
@@ -0,0 +1,113 @@
+package variable
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key 以板子和地址区分一个变量，不同板子上的同一地址互不相干；
+// 同一存储单元中的几个位域，再以位的位置区分；
+// 整块订阅的结构体与它的首个成员地址相同，再以长度区分；
+// 经由指针的变量在指针读出之前没有地址，以指针的地址和偏移区分
+type Key struct {
+	Board     uint8
+	Addr      uint32
+	Length    int // 整块订阅才有
+	BitOffset int
+	BitSize   int
+	Ptr       uint32 // 指针还没读出时才有
+	Offset    int
+}
+
+// KeyOf 返回变量的 Key
+func KeyOf(v T) Key {
+	k := Key{Board: v.Board, Addr: v.Addr, BitOffset: v.BitOffset, BitSize: v.BitSize}
+	if len(v.Fields) != 0 {
+		k.Length = v.Len()
+	}
+	if v.Unresolved() {
+		k.Ptr = v.Ptr.Addr
+		k.Offset = v.Ptr.Offset
+	}
+	return k
+}
+
+// unit 是变量所在的存储单元，同一单元只订阅一次
+func (k Key) unit() Key {
+	return Key{Board: k.Board, Addr: k.Addr}
+}
+
+// MarshalText 形如 1:0x20000000，整块订阅形如 1:0x20000000/12，
+// 位域形如 1:0x20000000.3+5，指针还没读出时形如 1:*0x20000000+8，用作json的键
+func (k Key) MarshalText() ([]byte, error) {
+	s := fmt.Sprintf("%d:0x%08x", k.Board, k.Addr)
+	if k.Ptr != 0 {
+		s = fmt.Sprintf("%d:*0x%08x+%d", k.Board, k.Ptr, k.Offset)
+	}
+	if k.Length != 0 {
+		s += fmt.Sprintf("/%d", k.Length)
+	}
+	if k.BitSize != 0 {
+		s += fmt.Sprintf(".%d+%d", k.BitOffset, k.BitSize)
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText 也接受旧版本以十进制地址为键的文件，此时视作板子1
+func (k *Key) UnmarshalText(b []byte) error {
+	s := string(b)
+	board := uint64(Board1)
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		var err error
+		board, err = strconv.ParseUint(s[:i], 10, 8)
+		if err != nil {
+			return err
+		}
+		s = s[i+1:]
+	}
+	var off, size int
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		if _, err := fmt.Sscanf(s[i+1:], "%d+%d", &off, &size); err != nil {
+			return err
+		}
+		s = s[:i]
+	}
+	length := 0
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return err
+		}
+		length = n
+		s = s[:i]
+	}
+	var ptr uint64
+	offset := 0
+	if strings.HasPrefix(s, "*") {
+		i := strings.IndexByte(s, '+')
+		if i < 0 {
+			return fmt.Errorf("pointer key without offset: %s", b)
+		}
+		var err error
+		if ptr, err = strconv.ParseUint(s[1:i], 0, 32); err != nil {
+			return err
+		}
+		if offset, err = strconv.Atoi(s[i+1:]); err != nil {
+			return err
+		}
+		s = "0"
+	}
+	addr, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return err
+	}
+	k.Board = uint8(board)
+	k.Addr = uint32(addr)
+	k.Ptr = uint32(ptr)
+	k.Offset = offset
+	k.Length = length
+	k.BitOffset = off
+	k.BitSize = size
+	return nil
+}
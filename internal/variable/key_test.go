@@ -0,0 +1,78 @@
+package variable
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestKeyJson(t *testing.T) {
+	m := map[Key]T{
+		{Board: 1, Addr: 0x20000000}: {Board: 1, Name: "a", Addr: 0x20000000},
+		{Board: 2, Addr: 0x20000000}: {Board: 2, Name: "b", Addr: 0x20000000},
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"1:0x20000000":{"Board":1,"Name":"a","Type":"","Addr":536870912,"Data":0,"Tick":0,"Inputcolor":"","SignalGain":0,"SignalBias":0},` +
+		`"2:0x20000000":{"Board":2,"Name":"b","Type":"","Addr":536870912,"Data":0,"Tick":0,"Inputcolor":"","SignalGain":0,"SignalBias":0}}`
+	if string(b) != want {
+		t.Errorf("\n\thave: %s\n\twant: %s", b, want)
+	}
+
+	got := map[Key]T{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[Key{Board: 2, Addr: 0x20000000}].Name != "b" {
+		t.Errorf("Unmarshal got %v", got)
+	}
+
+	// 旧版本的文件以十进制地址为键
+	legacy := map[Key]T{}
+	if err := json.Unmarshal([]byte(`{"536870912":{"Board":1,"Name":"a"}}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := legacy[Key{Board: 1, Addr: 0x20000000}]; !ok {
+		t.Errorf("legacy key not parsed: %v", legacy)
+	}
+
+	// 同一存储单元中的两个位域各有各的键
+	bits := map[Key]T{
+		{Board: 1, Addr: 0x20000000, BitOffset: 0, BitSize: 3}: {Name: "f.a"},
+		{Board: 1, Addr: 0x20000000, BitOffset: 3, BitSize: 5}: {Name: "f.b"},
+	}
+	b, err = json.Marshal(bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"1:0x20000000.3+5":`) {
+		t.Errorf("bit key %s", b)
+	}
+	got = map[Key]T{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[Key{Board: 1, Addr: 0x20000000, BitOffset: 3, BitSize: 5}].Name != "f.b" {
+		t.Errorf("Unmarshal got %v", got)
+	}
+
+	// 整块订阅的结构体与它的首个成员地址相同，以长度区分
+	whole := T{Board: 1, Name: "imu", Addr: 0x20000000, Fields: []FieldT{
+		{Name: "x", Offset: 0, Type: "float"},
+		{Name: "y", Offset: 4, Type: "float"},
+	}}
+	first := T{Board: 1, Name: "imu.x", Type: "float", Addr: 0x20000000}
+	if KeyOf(whole) == KeyOf(first) {
+		t.Errorf("snapshot key %v clashes with its first member", KeyOf(whole))
+	}
+	b, _ = json.Marshal(map[Key]T{KeyOf(whole): whole, KeyOf(first): first})
+	got = map[Key]T{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"1:0x20000000/8":`) || got[KeyOf(whole)].Name != "imu" || got[KeyOf(first)].Name != "imu.x" {
+		t.Errorf("snapshot keys %s", b)
+	}
+}
@@ -60,6 +60,39 @@ func JsonLoadAll() {
 	glog.Infoln(jsonPath[RD], "load success.")
 	glog.Infoln(jsonPath[WR], "load success.")
 
+	// 旧版本的键里没有位域的位置，照着变量重新算一遍
+	to[RD].m = rekey(to[RD].m)
+	to[WR].m = rekey(to[WR].m)
+	to[RD].temp = false
+	to[WR].temp = false
+
 	jsonfile.Save(jsonPath[RD], to[RD].m)
 	jsonfile.Save(jsonPath[WR], to[WR].m)
 }
+
+// SetDir 换一个文件夹存放变量列表，清空当前的列表后从中载入，切换工程时用
+func SetDir(dir string) {
+	func() {
+		to[RD].Lock()
+		defer to[RD].Unlock()
+		to[WR].Lock()
+		defer to[WR].Unlock()
+
+		jsonPath[RD] = path.Join(dir, "vToRead.json")
+		jsonPath[WR] = path.Join(dir, "vToWrite.json")
+		to[RD].m = make(map[Key]T)
+		to[WR].m = make(map[Key]T)
+	}()
+	JsonLoadAll()
+}
+
+func rekey(m map[Key]T) map[Key]T {
+	n := make(map[Key]T, len(m))
+	for k, v := range m {
+		if v.Board == 0 {
+			v.Board = k.Board
+		}
+		n[KeyOf(v)] = v
+	}
+	return n
+}
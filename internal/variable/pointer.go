@@ -0,0 +1,62 @@
+package variable
+
+// PtrT 是指针所指的变量：先读出指针，加上偏移才是变量的地址
+type PtrT struct {
+	Addr   uint32 // 指针变量的地址
+	Size   int    // 指针的字节数
+	Offset int    // 相对于指针所指地址的偏移
+}
+
+// Target 由读出的指针算出变量的地址，空指针或超出 4 字节地址时返回 false
+func (p PtrT) Target(data []byte) (uint32, bool) {
+	var x uint64
+	if p.Size == 8 {
+		x = BytesToUint64(data)
+	} else {
+		x = uint64(BytesToUint32(data))
+	}
+	if x == 0 {
+		return 0, false
+	}
+	x += uint64(p.Offset)
+	if x > 0xFFFFFFFF {
+		return 0, false
+	}
+	return uint32(x), true
+}
+
+// Unresolved 经由指针的变量，指针还没读出过，不知道在哪里
+func (v T) Unresolved() bool {
+	return v.Ptr != nil && v.Addr == 0
+}
+
+// GetPointers 返回所有经由指针找到的变量
+func GetPointers(o Mod) []T {
+	to[o].RLock()
+	defer to[o].RUnlock()
+	l := []T{}
+	for _, v := range to[o].m {
+		if v.Ptr != nil {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// Move 指针变了，变量搬到新的地址；新地址已有别的变量时不搬
+func Move(o Mod, k Key, addr uint32) bool {
+	to[o].Lock()
+	defer to[o].Unlock()
+	v, ok := to[o].m[k]
+	if !ok {
+		return false
+	}
+	v.Addr = addr
+	if _, ok := to[o].m[KeyOf(v)]; ok {
+		return false
+	}
+	delete(to[o].m, k)
+	to[o].m[KeyOf(v)] = v
+	save(o)
+	return true
+}
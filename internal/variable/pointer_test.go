@@ -0,0 +1,93 @@
+package variable
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPtrTarget(t *testing.T) {
+	p := PtrT{Addr: 0x20000000, Size: 4, Offset: 8}
+	if a, ok := p.Target([]byte{0x00, 0x04, 0x00, 0x20}); !ok || a != 0x20000408 {
+		t.Errorf("Target = %#x, %v", a, ok)
+	}
+	if _, ok := p.Target([]byte{0, 0, 0, 0}); ok {
+		t.Errorf("null pointer resolved")
+	}
+	p.Size = 8
+	if _, ok := p.Target([]byte{0, 0, 0, 0, 1, 0, 0, 0}); ok {
+		t.Errorf("address beyond 32 bits resolved")
+	}
+}
+
+func TestMove(t *testing.T) {
+	ptr := &PtrT{Addr: 0x20000000, Size: 4}
+	UseAll(RD, map[Key]T{
+		{Board: 1, Addr: 0x20000100}: {Board: 1, Name: "p->a", Addr: 0x20000100, Ptr: ptr},
+		{Board: 1, Addr: 0x20000200}: {Board: 1, Name: "b", Addr: 0x20000200},
+	})
+	defer UseAll(RD, map[Key]T{})
+	// 命令行临时用的列表，指针搬了也不能写进用户的文件
+	old := jsonPath[RD]
+	jsonPath[RD] = path.Join(t.TempDir(), "vToRead.json")
+	defer func() { jsonPath[RD] = old }()
+
+	if l := GetPointers(RD); len(l) != 1 || l[0].Name != "p->a" {
+		t.Fatalf("GetPointers = %v", l)
+	}
+	if Move(RD, Key{Board: 1, Addr: 0x20000100}, 0x20000200) {
+		t.Errorf("moved onto another variable")
+	}
+	if !Move(RD, Key{Board: 1, Addr: 0x20000100}, 0x20000300) {
+		t.Fatalf("not moved")
+	}
+	if v, ok := Get(RD, Key{Board: 1, Addr: 0x20000300}); !ok || v.Name != "p->a" {
+		t.Errorf("Get = %v, %v", v, ok)
+	}
+	if _, ok := Get(RD, Key{Board: 1, Addr: 0x20000100}); ok {
+		t.Errorf("old key kept")
+	}
+	if _, err := os.Stat(jsonPath[RD]); !os.IsNotExist(err) {
+		t.Errorf("temporary list saved: %v", err)
+	}
+}
+
+func TestUnresolved(t *testing.T) {
+	// 指针还是空的，两个成员都存得下，却都不订阅
+	a := T{Board: 1, Name: "p->a", Type: "float", Ptr: &PtrT{Addr: 0x20000000, Size: 4}}
+	b := T{Board: 1, Name: "p->b", Type: "float", Ptr: &PtrT{Addr: 0x20000000, Size: 4, Offset: 4}}
+	if !a.Unresolved() || KeyOf(a) == KeyOf(b) {
+		t.Fatalf("keys %v %v", KeyOf(a), KeyOf(b))
+	}
+	UseAll(RD, map[Key]T{KeyOf(a): a, KeyOf(b): b})
+	defer UseAll(RD, map[Key]T{})
+	defer ResetSubs()
+
+	js, err := json.Marshal(to[RD].m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"1:*0x20000000+4":`) {
+		t.Errorf("pointer key %s", js)
+	}
+	got := map[Key]T{}
+	if err := json.Unmarshal(js, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got[KeyOf(b)].Name != "p->b" {
+		t.Errorf("Unmarshal got %v", got)
+	}
+
+	if _, add, _ := Filt(nil); len(add) != 0 {
+		t.Errorf("subscribed before resolved: %v", add)
+	}
+	// 指针读出后搬过去，这才订阅
+	if !Move(RD, KeyOf(b), 0x20000104) {
+		t.Fatal("not moved")
+	}
+	if _, add, _ := Filt(nil); len(add) != 1 || add[0].Addr != 0x20000104 {
+		t.Errorf("add = %v", add)
+	}
+}
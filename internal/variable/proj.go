@@ -6,50 +6,101 @@ import (
 )
 
 type ProjT struct {
-	Addr string
-	Name string
-	Type string
+	Addr   string
+	Name   string
+	Type   string
+	Fields []FieldT `json:",omitempty"` // 结构体或数组的各个成员，可以整块订阅
+
+	Enum      []EnumT `json:",omitempty"` // 枚举的各个取值
+	BitOffset int     `json:",omitempty"` // 位域在存储单元中的起始位，从最低位数起
+	BitSize   int     `json:",omitempty"` // 位域的位数
+
+	Region string `json:",omitempty"` // 所在的内存区域，如 .data、.bss
+
+	Pointee string `json:",omitempty"` // 指针变量所指的类型
+	Ptr     *PtrT  `json:",omitempty"` // 经由指针找到的变量，Addr 是指针变量的地址
+}
+
+// Apply 把工程变量的结构记到变量上
+func (p ProjT) Apply(v *T) {
+	v.Fields = p.Fields
+	v.Enum = p.Enum
+	v.BitOffset = p.BitOffset
+	v.BitSize = p.BitSize
+	v.Ptr = p.Ptr
 }
 
 type Projs map[string]ProjT
 
+// AllBoards 的工程变量对每块电路板都适用，单独给某块板子载入的工程文件优先
+const AllBoards uint8 = 0
+
 type projMapType struct { // 一个读写锁保护的线程安全的map
 	sync.RWMutex // 读写锁保护下面的map字段
-	m            Projs
+	m            map[uint8]Projs
 }
 
 var toProj projMapType = projMapType{
-	m: make(Projs, 0),
+	m: make(map[uint8]Projs),
+}
+
+// of 找电路板的工程变量，没有单独载入时用 AllBoards 的，须在锁内调用
+func (p *projMapType) of(board uint8) Projs {
+	if m, ok := p.m[board]; ok {
+		return m
+	}
+	return p.m[AllBoards]
 }
 
-func SetAllProj(m Projs) {
+func SetAllProj(board uint8, m Projs) {
 	toProj.Lock() // 锁保护
 	defer toProj.Unlock()
-	toProj.m = m
+	toProj.m[board] = m
 }
 
-// 以json格式获取所有Proj变量
-func GetAllProj() ([]byte, error) {
+// 以json格式获取电路板的所有Proj变量
+func GetAllProj(board uint8) ([]byte, error) {
 	toProj.RLock() // 锁保护
 	defer toProj.RUnlock()
-	return json.Marshal(toProj.m)
+	m := toProj.of(board)
+	if m == nil {
+		m = Projs{}
+	}
+	return json.Marshal(m)
 }
 
-func GetProj(k string) (ProjT, bool) { //从map中读取一个值
+func GetProj(board uint8, k string) (ProjT, bool) { //从map中读取一个值
 	toProj.RLock()
 	defer toProj.RUnlock()
-	v, existed := toProj.m[k] // 在锁的保护下从map中读取
+	v, existed := toProj.of(board)[k] // 在锁的保护下从map中读取
 	return v, existed
 }
 
-func SetProj(k string, v ProjT) { // 设置一个键值对
+func SetProj(board uint8, k string, v ProjT) { // 设置一个键值对
 	toProj.Lock() // 锁保护
 	defer toProj.Unlock()
-	toProj.m[k] = v
+	if toProj.m[board] == nil {
+		toProj.m[board] = Projs{}
+	}
+	toProj.m[board][k] = v
 }
 
-func DeleteProj(k string) { //删除一个键
+func DeleteProj(board uint8, k string) { //删除一个键
 	toProj.Lock() // 锁保护
 	defer toProj.Unlock()
-	delete(toProj.m, k)
+	delete(toProj.m[board], k)
+}
+
+// ClearProj 卸下电路板的工程变量，之后沿用 AllBoards 的
+func ClearProj(board uint8) {
+	toProj.Lock()
+	defer toProj.Unlock()
+	delete(toProj.m, board)
+}
+
+// ClearAllProj 卸下所有工程变量，切换工程时用
+func ClearAllProj() {
+	toProj.Lock()
+	defer toProj.Unlock()
+	toProj.m = make(map[uint8]Projs)
 }
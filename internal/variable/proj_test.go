@@ -0,0 +1,30 @@
+package variable
+
+import "testing"
+
+func TestProjOfBoard(t *testing.T) {
+	SetAllProj(AllBoards, Projs{"kp": {Name: "kp", Addr: "0x20000100", Type: "float"}})
+	SetAllProj(Board2, Projs{"kp": {Name: "kp", Addr: "0x20000200", Type: "float"}})
+	defer ClearAllProj()
+
+	// 没有单独载入工程文件的板子用 AllBoards 的
+	if p, ok := GetProj(Board1, "kp"); !ok || p.Addr != "0x20000100" {
+		t.Errorf("board 1: %v %t", p, ok)
+	}
+	if p, ok := GetProj(Board2, "kp"); !ok || p.Addr != "0x20000200" {
+		t.Errorf("board 2: %v %t", p, ok)
+	}
+	if r, _ := SearchProj(QueryT{Board: Board2, Q: "kp"}); r.Total != 1 || r.Variables[0].Addr != "0x20000200" {
+		t.Errorf("search board 2: %v", r)
+	}
+
+	ClearProj(Board2)
+	if p, ok := GetProj(Board2, "kp"); !ok || p.Addr != "0x20000100" {
+		t.Errorf("board 2 cleared: %v %t", p, ok)
+	}
+
+	ClearAllProj()
+	if b, _ := GetAllProj(Board1); string(b) != "{}" {
+		t.Errorf("cleared: %s", b)
+	}
+}
@@ -16,33 +16,55 @@ const (
 
 // 用于存储变量修改信息的结构体
 type T struct {
-	Board      uint8   //板子ID
-	Name       string  //变量名
-	Type       string  //变量类型
-	Addr       uint32  //变量地址
-	Data       float64 //要写入的数据
-	Tick       uint32  //
-	Inputcolor string  //颜色
-	SignalGain float64 //增益
-	SignalBias float64 //偏置
+	Board      uint8    //板子ID
+	Name       string   //变量名
+	Type       string   //变量类型
+	Addr       uint32   //变量地址
+	Data       float64  //要写入的数据
+	Tick       uint32   //
+	Inputcolor string   //颜色
+	SignalGain float64  //增益
+	SignalBias float64  //偏置
+	Fields     []FieldT `json:",omitempty"` //结构体或数组整块订阅时的各个成员
+	Enum       []EnumT  `json:",omitempty"` //枚举的各个取值
+	BitOffset  int      `json:",omitempty"` //位域在存储单元中的起始位，从最低位数起
+	BitSize    int      `json:",omitempty"` //位域的位数，不是位域时为0
+	Ptr        *PtrT    `json:",omitempty"` //经由指针找到的变量，Addr 是指针所指之处
 }
 
 type RWMap struct { // 一个读写锁保护的线程安全的map
 	sync.RWMutex // 读写锁保护下面的map字段
-	m            map[uint32]T
+	m            map[Key]T
+	temp         bool // 由 UseAll 设置的临时列表，不保存到json文件
+}
+
+// save 将map的内容保存到json文件中，临时列表不保存，须在锁内调用
+func save(o Mod) {
+	if !to[o].temp {
+		jsonfile.Save(jsonPath[o], to[o].m)
+	}
 }
 
 var to []RWMap = []RWMap{{
-	m: make(map[uint32]T),
+	m: make(map[Key]T),
 }, {
-	m: make(map[uint32]T),
+	m: make(map[Key]T),
 }}
 
-func SetAll(o Mod, v map[uint32]T) {
+func SetAll(o Mod, v map[Key]T) {
 	to[o].Lock() // 锁保护
 	defer to[o].Unlock()
 	to[o].m = v
-	jsonfile.Save(jsonPath[o], to[o].m)
+	to[o].temp = false
+	save(o)
+}
+
+// UseAll 设置所有Mod变量，但不保存到json文件，供命令行临时使用；此后的改动也不保存
+func UseAll(o Mod, v map[Key]T) {
+	to[o].Lock()
+	defer to[o].Unlock()
+	to[o].m = v
+	to[o].temp = true
 }
 
 // GetAll 以json格式获取所有Mod变量
@@ -52,7 +74,7 @@ func GetAll(o Mod) ([]byte, error) {
 	return json.Marshal(to[o].m)
 }
 
-func GetKeys(o Mod) (keys []uint32) {
+func GetKeys(o Mod) (keys []Key) {
 	to[o].RLock() // 锁保护
 	defer to[o].RUnlock()
 	for k := range to[o].m {
@@ -63,32 +85,73 @@ func GetKeys(o Mod) (keys []uint32) {
 
 // Get 从map中读取一个值
 // o 是 Mod 类型的参数，表示map的模块
-// k 是 uint32 类型的参数，表示要查找的键
+// k 是 Key 类型的参数，表示要查找的键
 // 返回值有两个：T 类型的值和一个bool类型，表示该键是否存在
-func Get(o Mod, k uint32) (T, bool) {
+func Get(o Mod, k Key) (T, bool) {
 	to[o].RLock()            // 为读取操作加上读锁
 	defer to[o].RUnlock()    // 函数执行完毕后释放读锁
 	v, existed := to[o].m[k] // 在锁的保护下从map中读取值
 	return v, existed        // 返回读取到的值和是否存在的bool值
 }
 
+// GetByName 通过变量名从map中查找一个值
+// o 是 Mod 类型的参数，表示map的模块
+// name 是要查找的变量名
+// 返回值有两个：T 类型的值和一个bool类型，表示该变量是否存在
+func GetByName(o Mod, name string) (T, bool) {
+	to[o].RLock()
+	defer to[o].RUnlock()
+	for _, v := range to[o].m {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return T{}, false
+}
+
+// GetByBoardName 通过电路板和变量名查找一个值，不同板子上可以有同名的变量
+func GetByBoardName(o Mod, board uint8, name string) (T, bool) {
+	to[o].RLock()
+	defer to[o].RUnlock()
+	for _, v := range to[o].m {
+		if v.Board == board && v.Name == name {
+			return v, true
+		}
+	}
+	return T{}, false
+}
+
+// Find 找出前端所说的那个已添加的变量。前端只带来板子、名字、类型与地址，
+// 位域的位置和枚举要从这里找；同一处有好几个变量时以名字区分。
+// 经由指针的变量随时会搬家，前端带来的地址或许已经过时，只认名字
+func Find(o Mod, v T) (T, bool) {
+	to[o].RLock()
+	defer to[o].RUnlock()
+	for _, r := range to[o].m {
+		if r.Board == v.Board && (r.Addr == v.Addr || r.Ptr != nil) && r.Name == v.Name {
+			return r, true
+		}
+	}
+	return T{}, false
+}
+
 // Set 设置一个键值对到map中
 // o 是 Mod 类型的参数，表示map的模块
-// k 是 uint32 类型的参数，表示要设置的键
+// k 是 Key 类型的参数，表示要设置的键
 // v 是 T 类型的参数，表示要设置的值
-func Set(o Mod, k uint32, v T) {
-	to[o].Lock()                        // 为写入操作加上写锁
-	defer to[o].Unlock()                // 函数执行完毕后释放写锁
-	to[o].m[k] = v                      // 设置键值对到map中
-	jsonfile.Save(jsonPath[o], to[o].m) // 将map的内容保存到json文件中
+func Set(o Mod, k Key, v T) {
+	to[o].Lock()         // 为写入操作加上写锁
+	defer to[o].Unlock() // 函数执行完毕后释放写锁
+	to[o].m[k] = v       // 设置键值对到map中
+	save(o)              // 将map的内容保存到json文件中
 }
 
 // Delete 从map中删除一个键
 // o 是 Mod 类型的参数，表示map的模块
-// k 是 uint32 类型的参数，表示要删除的键
-func Delete(o Mod, k uint32) {
-	to[o].Lock()                        // 为删除操作加上写锁
-	defer to[o].Unlock()                // 函数执行完毕后释放写锁
-	delete(to[o].m, k)                  // 从map中删除键
-	jsonfile.Save(jsonPath[o], to[o].m) // 将map的剩余内容保存到json文件中
+// k 是 Key 类型的参数，表示要删除的键
+func Delete(o Mod, k Key) {
+	to[o].Lock()         // 为删除操作加上写锁
+	defer to[o].Unlock() // 函数执行完毕后释放写锁
+	delete(to[o].m, k)   // 从map中删除键
+	save(o)              // 将map的剩余内容保存到json文件中
 }
@@ -0,0 +1,143 @@
+package variable
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	SearchPrefix = "prefix" // 以关键字开头
+	SearchFuzzy  = "fuzzy"  // 关键字的字符依次出现，不分大小写
+	SearchRegex  = "regex"  // 正则表达式
+)
+
+const (
+	DefaultLimit = 50   // 每页默认的条数
+	MaxLimit     = 1000 // 每页至多的条数
+)
+
+var ErrSearchMode = errors.New("unknown search mode")
+
+// QueryT 是对工程变量的一次查找
+type QueryT struct {
+	Board   uint8  // 电路板，没有单独载入工程文件的板子用 AllBoards 的
+	Q       string // 关键字，空则不限
+	Mode    string // SearchPrefix、SearchFuzzy 或 SearchRegex，默认 SearchFuzzy
+	Type    string // 变量类型，空则不限
+	AddrMin uint32 // 地址下限，含
+	AddrMax uint32 // 地址上限，含；0 则不限
+	Offset  int
+	Limit   int // 0 则为 DefaultLimit
+}
+
+// SearchT 是一页查找结果，Total 为全部符合的条数
+type SearchT struct {
+	Total     int
+	Variables []ProjT
+}
+
+// page 按 Offset 和 Limit 取出一页的范围
+func page(n, offset, limit int) (int, int) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+	return offset, end
+}
+
+// fuzzyScore 关键字的字符依次出现在名字中时返回得分：连着的、在词首的得分高，名字短的得分高
+func fuzzyScore(name, q string) (int, bool) {
+	n := []rune(strings.ToLower(name))
+	score := 0
+	i, last := 0, -2
+	for _, c := range strings.ToLower(q) {
+		for i < len(n) && n[i] != c {
+			i++
+		}
+		if i == len(n) {
+			return 0, false
+		}
+		switch {
+		case i == last+1:
+			score += 3 // 连着
+		case i == 0 || !unicode.IsLetter(n[i-1]) && !unicode.IsDigit(n[i-1]):
+			score += 2 // 词首
+		default:
+			score++
+		}
+		last = i
+		i++
+	}
+	return score*100 - len(n), true
+}
+
+// SearchProj 查找工程变量，模糊查找按得分排列，其余按名字排列
+func SearchProj(q QueryT) (SearchT, error) {
+	var match func(string) (int, bool)
+	switch q.Mode {
+	case SearchPrefix:
+		match = func(n string) (int, bool) { return 0, strings.HasPrefix(n, q.Q) }
+	case SearchFuzzy, "":
+		match = func(n string) (int, bool) { return fuzzyScore(n, q.Q) }
+	case SearchRegex:
+		re, err := regexp.Compile(q.Q)
+		if err != nil {
+			return SearchT{}, err
+		}
+		match = func(n string) (int, bool) { return 0, re.MatchString(n) }
+	default:
+		return SearchT{}, ErrSearchMode
+	}
+
+	type hit struct {
+		p     ProjT
+		score int
+	}
+	hits := []hit{}
+	toProj.RLock()
+	for _, p := range toProj.of(q.Board) {
+		if q.Type != "" && p.Type != q.Type {
+			continue
+		}
+		if q.AddrMin != 0 || q.AddrMax != 0 {
+			a, err := strconv.ParseUint(p.Addr, 0, 32)
+			if err != nil || uint32(a) < q.AddrMin || q.AddrMax != 0 && uint32(a) > q.AddrMax {
+				continue
+			}
+		}
+		if s, ok := match(p.Name); ok {
+			hits = append(hits, hit{p, s})
+		}
+	}
+	toProj.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].p.Name < hits[j].p.Name
+	})
+
+	r := SearchT{Total: len(hits), Variables: []ProjT{}}
+	start, end := page(len(hits), q.Offset, q.Limit)
+	for _, h := range hits[start:end] {
+		r.Variables = append(r.Variables, h.p)
+	}
+	return r, nil
+}
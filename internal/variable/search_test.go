@@ -0,0 +1,67 @@
+package variable
+
+import (
+	"reflect"
+	"testing"
+)
+
+func names(l []ProjT) []string {
+	n := []string{}
+	for _, p := range l {
+		n = append(n, p.Name)
+	}
+	return n
+}
+
+func TestSearchProj(t *testing.T) {
+	SetAllProj(AllBoards, Projs{
+		"g_chassis.speed":  {Name: "g_chassis.speed", Addr: "0x20000000", Type: "float"},
+		"g_chassis.mode":   {Name: "g_chassis.mode", Addr: "0x20000004", Type: "int32_t"},
+		"g_gimbal.yaw":     {Name: "g_gimbal.yaw", Addr: "0x20000100", Type: "float"},
+		"chassis_power":    {Name: "chassis_power", Addr: "0x20000200", Type: "float"},
+		"count::calls":     {Name: "count::calls", Addr: "0x20000300", Type: "int32_t"},
+		"g_chassis->speed": {Name: "g_chassis->speed", Addr: "0x20000400", Type: "float"},
+	})
+	defer ClearAllProj()
+
+	cases := []struct {
+		q    QueryT
+		want []string
+	}{
+		{QueryT{Q: "g_chassis.", Mode: SearchPrefix}, []string{"g_chassis.mode", "g_chassis.speed"}},
+		{QueryT{Q: "chspd"}, []string{"g_chassis.speed", "g_chassis->speed"}},
+		{QueryT{Q: "power"}, []string{"chassis_power"}},
+		{QueryT{Q: `^g_\w+\.(yaw|mode)$`, Mode: SearchRegex}, []string{"g_chassis.mode", "g_gimbal.yaw"}},
+		{QueryT{Type: "int32_t"}, []string{"count::calls", "g_chassis.mode"}},
+		{QueryT{AddrMin: 0x20000100, AddrMax: 0x20000300, Mode: SearchPrefix}, []string{"chassis_power", "count::calls", "g_gimbal.yaw"}},
+		{QueryT{Mode: SearchPrefix, Offset: 1, Limit: 2}, []string{"count::calls", "g_chassis->speed"}},
+	}
+	for i, c := range cases {
+		r, err := SearchProj(c.q)
+		if err != nil || !reflect.DeepEqual(names(r.Variables), c.want) {
+			t.Errorf("%d: SearchProj = %v, %v, want %v", i, names(r.Variables), err, c.want)
+		}
+	}
+
+	if r, _ := SearchProj(QueryT{Mode: SearchPrefix, Limit: 2}); r.Total != 6 {
+		t.Errorf("Total = %d", r.Total)
+	}
+	if _, err := SearchProj(QueryT{Q: "(", Mode: SearchRegex}); err == nil {
+		t.Errorf("bad regex accepted")
+	}
+	if _, err := SearchProj(QueryT{Mode: "glob"}); err != ErrSearchMode {
+		t.Errorf("bad mode: %v", err)
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	// 连着的比分散的好
+	a, _ := fuzzyScore("g_chassis.speed", "speed")
+	b, _ := fuzzyScore("g_chassis.spin_period", "speed")
+	if a <= b {
+		t.Errorf("%d <= %d", a, b)
+	}
+	if _, ok := fuzzyScore("yaw", "yaww"); ok {
+		t.Errorf("matched")
+	}
+}
@@ -0,0 +1,54 @@
+package variable
+
+import "sort"
+
+// FieldT 是整块订阅的结构体或数组中的一个成员
+type FieldT struct {
+	Name      string // 相对于变量的名字，如 acc.[0]
+	Offset    int    // 相对于变量地址的偏移
+	Type      string
+	BitOffset int `json:",omitempty"` // 位域在存储单元中的起始位
+	BitSize   int `json:",omitempty"` // 位域的位数
+}
+
+// Len 订阅时要读的字节数，整块订阅时读到最后一个成员为止
+func (v T) Len() int {
+	if len(v.Fields) == 0 {
+		return TypeLen[v.Type]
+	}
+	n := 0
+	for _, f := range v.Fields {
+		if e := f.Offset + TypeLen[f.Type]; e > n {
+			n = e
+		}
+	}
+	return n
+}
+
+// SortFields 按偏移排列成员
+func SortFields(l []FieldT) {
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Offset != l[j].Offset {
+			return l[i].Offset < l[j].Offset
+		}
+		return l[i].Name < l[j].Name
+	})
+}
+
+// snapshot 把同一时刻采下的整块数据拆成各个成员的曲线，它们共用同一个时间戳
+func (v T) snapshot(data []byte) []ChartT {
+	chart := make([]ChartT, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		end := f.Offset + TypeLen[f.Type]
+		if f.Offset < 0 || end > len(data) || end == f.Offset {
+			continue
+		}
+		chart = append(chart, ChartT{
+			Board: v.Board,
+			Name:  v.Name + "." + f.Name,
+			Data:  v.SignalGain*decode(f.Type, data[f.Offset:end], f.BitOffset, f.BitSize) + v.SignalBias,
+			Tick:  v.Tick,
+		})
+	}
+	return chart
+}
@@ -0,0 +1,60 @@
+package variable
+
+import "testing"
+
+func TestSnapshot(t *testing.T) {
+	v := T{
+		Board:      1,
+		Name:       "imu",
+		Type:       "struct IMU",
+		Addr:       0x20000000,
+		SignalGain: 2,
+		Fields: []FieldT{
+			{Name: "acc.[0]", Offset: 0, Type: "float"},
+			{Name: "acc.[1]", Offset: 4, Type: "float"},
+			{Name: "temp", Offset: 8, Type: "int16_t"},
+		},
+	}
+	if n := v.Len(); n != 10 {
+		t.Errorf("Len = %d, want 10", n)
+	}
+
+	to[RD].Lock()
+	old := to[RD].m
+	to[RD].m = map[Key]T{KeyOf(v): v}
+	to[RD].Unlock()
+	defer func() {
+		to[RD].Lock()
+		to[RD].m = old
+		to[RD].Unlock()
+	}()
+	ResetSubs()
+	defer ResetSubs()
+
+	_, add, _ := Filt(nil)
+	if len(add) != 1 || add[0].Length != 10 {
+		t.Fatalf("add %v", add)
+	}
+
+	data := append(append(SpecToBytes("float", 1.5), SpecToBytes("float", -2)...), SpecToBytes("int16_t", 300)...)
+	chart, _, _ := Filt([]CmdT{{Act: SubscribeReturn, Board: 1, Addr: 0x20000000, Length: 10, Tick: 7, Data: data}})
+	want := []ChartT{
+		{Board: 1, Name: "imu.acc.[0]", Data: 3, Tick: 7},
+		{Board: 1, Name: "imu.acc.[1]", Data: -4, Tick: 7},
+		{Board: 1, Name: "imu.temp", Data: 600, Tick: 7},
+	}
+	if len(chart) != len(want) {
+		t.Fatalf("chart %v", chart)
+	}
+	for i := range want {
+		if chart[i] != want[i] {
+			t.Errorf("chart[%d]\n\thave: %+v\n\twant: %+v", i, chart[i], want[i])
+		}
+	}
+
+	// 数据不够长的成员只好略过
+	chart, _, _ = Filt([]CmdT{{Act: SubscribeReturn, Board: 1, Addr: 0x20000000, Length: 8, Data: data[:8]}})
+	if len(chart) != 2 {
+		t.Errorf("short chart %v", chart)
+	}
+}
@@ -0,0 +1,210 @@
+package variable
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SubState 是一个订阅所处的状态
+type SubState int
+
+const (
+	_                SubState = iota
+	SubRequested              // 已发出订阅，等待回音
+	SubAcknowledged           // 收到了第一个回音
+	SubStreaming              // 回音源源不断
+	SubStale                  // 许久没有回音，需要重新订阅
+	SubUnsubscribing          // 已发出取消订阅，等待回应
+)
+
+var subStateText = map[SubState]string{
+	SubRequested:     "requested",
+	SubAcknowledged:  "acknowledged",
+	SubStreaming:     "streaming",
+	SubStale:         "stale",
+	SubUnsubscribing: "unsubscribing",
+}
+
+func (s SubState) String() string {
+	return subStateText[s]
+}
+
+func (s SubState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+const (
+	subAckTimeout   = time.Second // 发出订阅后等待回音的时间
+	subStaleTimeout = time.Second // 没有回音多久算作失联
+	unsubTimeout    = time.Second // 发出取消订阅后等待回应的时间
+)
+
+// SubT 记录一个订阅的状况
+type SubT struct {
+	Board    uint8
+	Length   int
+	Addr     uint32
+	State    SubState
+	Since    time.Time // 进入当前状态的时间
+	LastSeen time.Time // 最后一次收到回音的时间
+	Count    uint64    // 收到回音的次数
+	Requests int       // 发出订阅的次数
+}
+
+func subKeyOf(v CmdT) Key {
+	return Key{Board: v.Board, Addr: v.Addr}
+}
+
+var subs = struct {
+	sync.Mutex
+	m map[Key]*SubT
+}{
+	m: map[Key]*SubT{},
+}
+
+// 便于测试时拨动时钟
+var now = time.Now
+
+func (s *SubT) setState(st SubState, t time.Time) {
+	if s.State != st {
+		s.State = st
+		s.Since = t
+	}
+}
+
+// refresh 根据时间推算是否已经失联
+func (s *SubT) refresh(t time.Time) {
+	switch s.State {
+	case SubRequested:
+		if t.Sub(s.Since) > subAckTimeout {
+			s.setState(SubStale, t)
+		}
+	case SubAcknowledged, SubStreaming:
+		if t.Sub(s.LastSeen) > subStaleTimeout {
+			s.setState(SubStale, t)
+		}
+	}
+}
+
+// SubSent 记录发出的订阅或取消订阅
+func SubSent(act ActMode, v CmdT) {
+	subs.Lock()
+	defer subs.Unlock()
+	t := now()
+	k := subKeyOf(v)
+	s, ok := subs.m[k]
+	if !ok {
+		s = &SubT{Board: v.Board, Length: v.Length, Addr: v.Addr}
+		subs.m[k] = s
+	}
+	switch act {
+	case Subscribe:
+		s.Length = v.Length
+		s.Requests++
+		s.setState(SubRequested, t)
+		s.Since = t
+	case Unsubscribe:
+		s.setState(SubUnsubscribing, t)
+		s.Since = t
+	}
+}
+
+// SubUnsubscribed 单片机确认取消订阅，不再记挂它
+func SubUnsubscribed(v CmdT) {
+	subs.Lock()
+	defer subs.Unlock()
+	k := subKeyOf(v)
+	if s, ok := subs.m[k]; ok && s.State == SubUnsubscribing {
+		delete(subs.m, k)
+	}
+}
+
+// ResetSubs 串口重新打开后，所有订阅都要从头来过
+func ResetSubs() {
+	subs.Lock()
+	defer subs.Unlock()
+	subs.m = map[Key]*SubT{}
+}
+
+// ResetSubsOf 板子所在的串口重新连上后，它的订阅要从头来过
+func ResetSubsOf(board uint8) {
+	subs.Lock()
+	defer subs.Unlock()
+	for k := range subs.m {
+		if k.Board == board {
+			delete(subs.m, k)
+		}
+	}
+}
+
+// GetSubs 返回所有订阅的状况
+func GetSubs() []SubT {
+	subs.Lock()
+	defer subs.Unlock()
+	t := now()
+	l := []SubT{}
+	for _, s := range subs.m {
+		s.refresh(t)
+		l = append(l, *s)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Board != l[j].Board {
+			return l[i].Board < l[j].Board
+		}
+		return l[i].Addr < l[j].Addr
+	})
+	return l
+}
+
+// subSeen 收到一个回音，wanted 表示是否仍挂念着它，返回是否需要取消订阅
+func subSeen(v CmdT, wanted bool, t time.Time) bool {
+	k := subKeyOf(v)
+	s, ok := subs.m[k]
+	if !ok {
+		s = &SubT{Board: v.Board, Length: v.Length, Addr: v.Addr}
+		subs.m[k] = s
+	}
+	s.LastSeen = t
+	s.Count++
+
+	if !wanted {
+		// 刚发过取消订阅，再等等
+		if s.State == SubUnsubscribing && t.Sub(s.Since) < unsubTimeout {
+			return false
+		}
+		return true
+	}
+
+	switch s.State {
+	case SubAcknowledged, SubStreaming:
+		s.setState(SubStreaming, t)
+	default:
+		s.setState(SubAcknowledged, t)
+	}
+	return false
+}
+
+// subNeeded 判断一个挂念着的变量是否需要（重新）订阅
+func subNeeded(v CmdT, t time.Time) bool {
+	s, ok := subs.m[subKeyOf(v)]
+	if !ok {
+		return true
+	}
+	s.refresh(t)
+	// 同一处新添了更长的变量，也要重新订阅
+	return s.State == SubStale || s.State == SubUnsubscribing || s.Length < v.Length
+}
+
+// subPrune 忘掉已不再挂念且早已沉默的订阅
+func subPrune(wanted func(Key) bool, t time.Time) {
+	for k, s := range subs.m {
+		if wanted(k) {
+			continue
+		}
+		s.refresh(t)
+		if s.State == SubStale || (s.State == SubUnsubscribing && t.Sub(s.Since) > unsubTimeout) {
+			delete(subs.m, k)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package variable
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubscription(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+	ResetSubs()
+
+	to[RD].Lock()
+	old := to[RD].m
+	to[RD].m = map[Key]T{
+		{Board: 1, Addr: 0x20000000}: {Board: 1, Name: "a", Type: "float", Addr: 0x20000000, SignalGain: 1},
+	}
+	to[RD].Unlock()
+	defer func() {
+		to[RD].Lock()
+		to[RD].m = old
+		to[RD].Unlock()
+	}()
+
+	a := CmdT{Board: 1, Length: 4, Addr: 0x20000000}
+	b := CmdT{Board: 1, Length: 4, Addr: 0x20000004}
+	sample := func(c CmdT) CmdT {
+		c.Act = SubscribeReturn
+		return c
+	}
+	state := func(c CmdT) SubState {
+		for _, s := range GetSubs() {
+			if s.Board == c.Board && s.Addr == c.Addr {
+				return s.State
+			}
+		}
+		return 0
+	}
+
+	// 从未订阅过，需要订阅
+	_, add, del := Filt(nil)
+	if len(add) != 1 || !reflect.DeepEqual(add[0], a) || len(del) != 0 {
+		t.Fatalf("first Filt: add %v, del %v", add, del)
+	}
+	SubSent(Subscribe, a)
+
+	// 已发出订阅，不必重复
+	clock = clock.Add(500 * time.Millisecond)
+	if _, add, _ := Filt(nil); len(add) != 0 {
+		t.Errorf("subscribe sent again while requested: %v", add)
+	}
+	if s := state(a); s != SubRequested {
+		t.Errorf("state %v, want requested", s)
+	}
+
+	// 收到回音
+	chart, _, _ := Filt([]CmdT{sample(a)})
+	if len(chart) != 1 || state(a) != SubAcknowledged {
+		t.Errorf("chart %v, state %v", chart, state(a))
+	}
+	clock = clock.Add(10 * time.Millisecond)
+	Filt([]CmdT{sample(a)})
+	if s := state(a); s != SubStreaming {
+		t.Errorf("state %v, want streaming", s)
+	}
+
+	// 不挂念的变量要取消订阅，但只取消一次
+	_, _, del = Filt([]CmdT{sample(b)})
+	if len(del) != 1 {
+		t.Fatalf("del %v", del)
+	}
+	SubSent(Unsubscribe, b)
+	if _, _, del = Filt([]CmdT{sample(b)}); len(del) != 0 {
+		t.Errorf("unsubscribe sent again: %v", del)
+	}
+	SubUnsubscribed(b)
+	if s := state(b); s != 0 {
+		t.Errorf("state %v after unsubscribed", s)
+	}
+
+	// 久无回音，重新订阅
+	clock = clock.Add(2 * time.Second)
+	if s := state(a); s != SubStale {
+		t.Errorf("state %v, want stale", s)
+	}
+	if _, add, _ := Filt(nil); len(add) != 1 {
+		t.Errorf("stale subscription not renewed: %v", add)
+	}
+
+	// 串口重新连上，板子的订阅从头来过
+	SubSent(Subscribe, a)
+	SubSent(Subscribe, CmdT{Board: 2, Length: 4, Addr: 0x20000000})
+	ResetSubsOf(1)
+	if s := state(a); s != 0 {
+		t.Errorf("state %v after reset", s)
+	}
+	if l := GetSubs(); len(l) != 1 || l[0].Board != 2 {
+		t.Errorf("other boards reset: %v", l)
+	}
+}
@@ -0,0 +1,133 @@
+package variable
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NodeT 是工程变量树上的一个节点。太大的结构体没有整块的工程变量，只有名字
+type NodeT struct {
+	ProjT
+	Label       string // 相对于上一层的名字，如 speed、[0]、->speed
+	HasChildren bool
+}
+
+// TreeT 是一页子节点，Total 为全部子节点的个数
+type TreeT struct {
+	Total int
+	Nodes []NodeT
+}
+
+// ParentOf 上一层的名字：成员与数组元素以 . 相连，指针所指以 -> 相连，*p 的上一层是 p
+func ParentOf(name string) string {
+	i := strings.LastIndex(name, ".")
+	if j := strings.LastIndex(name, "->"); j > i {
+		i = j
+	}
+	if i > 0 {
+		return name[:i]
+	}
+	if strings.HasPrefix(name, "*") {
+		return name[1:]
+	}
+	return ""
+}
+
+func labelOf(name, parent string) string {
+	if parent == "" {
+		return name
+	}
+	if name == "*"+parent {
+		return "*"
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, parent), ".")
+}
+
+// ProjChildren 列出 parent 的子节点，parent 为空时列出最上层的变量
+// 按地址排列，地址相同时按名字，名字中的数字按大小
+func ProjChildren(board uint8, parent string, offset, limit int) TreeT {
+	type child struct {
+		NodeT
+		addr uint64 // 子孙中最小的地址
+	}
+	m := map[string]*child{}
+
+	toProj.RLock()
+	for n, p := range toProj.of(board) {
+		a, err := strconv.ParseUint(p.Addr, 0, 32)
+		if err != nil {
+			continue
+		}
+		// 沿着祖先往上找，找到挂在 parent 下的那一个
+		for c := n; c != ""; c = ParentOf(c) {
+			if ParentOf(c) != parent {
+				continue
+			}
+			x, ok := m[c]
+			if !ok {
+				x = &child{NodeT: NodeT{ProjT: ProjT{Name: c}, Label: labelOf(c, parent)}, addr: a}
+				m[c] = x
+			}
+			if c == n {
+				x.ProjT = p
+			} else {
+				x.HasChildren = true
+			}
+			if a < x.addr {
+				x.addr = a
+			}
+			break
+		}
+	}
+	toProj.RUnlock()
+
+	l := []*child{}
+	for _, c := range m {
+		l = append(l, c)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].addr != l[j].addr {
+			return l[i].addr < l[j].addr
+		}
+		return naturalLess(l[i].Name, l[j].Name)
+	})
+
+	r := TreeT{Total: len(l), Nodes: []NodeT{}}
+	start, end := page(len(l), offset, limit)
+	for _, c := range l[start:end] {
+		r.Nodes = append(r.Nodes, c.NodeT)
+	}
+	return r
+}
+
+// naturalLess 比较名字，其中的数字按大小比较，[2] 在 [10] 之前
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := digits(a), digits(b)
+			x, _ := strconv.ParseUint(a[:i], 10, 64)
+			y, _ := strconv.ParseUint(b[:j], 10, 64)
+			if x != y {
+				return x < y
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func digits(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,62 @@
+package variable
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjChildren(t *testing.T) {
+	SetAllProj(AllBoards, Projs{
+		"g_arr.[10]":       {Name: "g_arr.[10]", Addr: "0x20000028", Type: "float"},
+		"g_arr.[2]":        {Name: "g_arr.[2]", Addr: "0x20000008", Type: "float"},
+		"g_big.pos.x":      {Name: "g_big.pos.x", Addr: "0x20000100", Type: "float"},
+		"g_chassis":        {Name: "g_chassis", Addr: "0x20000200", Type: "uint32_t", Pointee: "chassis_t"},
+		"g_chassis->speed": {Name: "g_chassis->speed", Addr: "0x20000200", Type: "float"},
+		"*g_chassis":       {Name: "*g_chassis", Addr: "0x20000200", Type: "chassis_t"},
+	})
+	defer ClearAllProj()
+
+	type node struct {
+		Label, Type string
+		HasChildren bool
+	}
+	cases := []struct {
+		parent string
+		want   []node
+	}{
+		{"", []node{{"g_arr", "", true}, {"g_big", "", true}, {"g_chassis", "uint32_t", true}}},
+		{"g_arr", []node{{"[2]", "float", false}, {"[10]", "float", false}}},
+		{"g_big", []node{{"pos", "", true}}},
+		{"g_chassis", []node{{"*", "chassis_t", false}, {"->speed", "float", false}}},
+		{"nothing", []node{}},
+	}
+	for _, c := range cases {
+		got := []node{}
+		for _, n := range ProjChildren(Board1, c.parent, 0, 0).Nodes {
+			got = append(got, node{n.Label, n.Type, n.HasChildren})
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: ProjChildren = %v, want %v", c.parent, got, c.want)
+		}
+	}
+
+	if r := ProjChildren(Board1, "g_arr", 1, 1); r.Total != 2 || len(r.Nodes) != 1 || r.Nodes[0].Name != "g_arr.[10]" {
+		t.Errorf("page %+v", r)
+	}
+}
+
+func TestParentOf(t *testing.T) {
+	for n, want := range map[string]string{
+		"a":            "",
+		"a.b.[3]":      "a.b",
+		"p->pos.x":     "p->pos",
+		"p->speed":     "p",
+		"*p":           "p",
+		"ns::g.x":      "ns::g",
+		"count::calls": "",
+	} {
+		if p := ParentOf(n); p != want {
+			t.Errorf("ParentOf(%q) = %q, want %q", n, p, want)
+		}
+	}
+}
@@ -15,16 +15,19 @@ func UpdateByProj() {
 		defer to[RD].Unlock()
 		NewToRead := to[RD].m
 		for k, v := range to[RD].m {
-			if p, ok := toProj.m[v.Name]; ok {
-				addr, err := strconv.ParseUint(p.Addr, 16, 32)
+			if p, ok := toProj.of(v.Board)[v.Name]; ok {
+				addr, err := strconv.ParseUint(p.Addr, 0, 32)
 				if err != nil {
 					glog.Errorln(err.Error())
 					continue
 				}
-				v.Addr = uint32(addr)
+				if p.Ptr == nil {
+					v.Addr = uint32(addr) // 经由指针的变量，地址等指针读出后再定
+				}
 				v.Type = p.Type
+				p.Apply(&v)
 				delete(NewToRead, k)
-				NewToRead[v.Addr] = v
+				NewToRead[KeyOf(v)] = v
 			}
 		}
 		to[RD].m = NewToRead
@@ -34,16 +37,19 @@ func UpdateByProj() {
 		defer to[WR].Unlock()
 		NewToModi := to[WR].m
 		for k, v := range to[WR].m {
-			if p, ok := toProj.m[v.Name]; ok {
-				addr, err := strconv.ParseUint(p.Addr, 16, 32)
+			if p, ok := toProj.of(v.Board)[v.Name]; ok {
+				addr, err := strconv.ParseUint(p.Addr, 0, 32)
 				if err != nil {
 					glog.Errorln(err.Error())
 					continue
 				}
-				v.Addr = uint32(addr)
+				if p.Ptr == nil {
+					v.Addr = uint32(addr) // 经由指针的变量，地址等指针读出后再定
+				}
 				v.Type = p.Type
+				p.Apply(&v)
 				delete(NewToModi, k)
-				NewToModi[v.Addr] = v
+				NewToModi[KeyOf(v)] = v
 			}
 		}
 		to[WR].m = NewToModi
@@ -7,8 +7,9 @@ import (
 	"runtime"
 	"strconv"
 
+	"github.com/scutrobotlab/asuwave/internal/cli"
 	"github.com/scutrobotlab/asuwave/internal/helper"
-	"github.com/scutrobotlab/asuwave/internal/option"
+	"github.com/scutrobotlab/asuwave/internal/project"
 	"github.com/scutrobotlab/asuwave/internal/serial"
 	"github.com/scutrobotlab/asuwave/internal/server"
 	"github.com/scutrobotlab/asuwave/pkg/elffile"
@@ -16,6 +17,7 @@ import (
 
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
+
 	vFlag := false
 	uFlag := false
 	bFlag := false
@@ -25,6 +27,16 @@ func main() {
 	flag.IntVar(&helper.Port, "p", 8888, "port to bind")
 	flag.Parse()
 
+	// 子命令，不启动服务器
+	switch flag.Arg(0) {
+	case "capture":
+		os.Exit(cli.Capture(flag.Args()[1:]))
+	case "write":
+		os.Exit(cli.Write(flag.Args()[1:]))
+	case "read":
+		os.Exit(cli.Read(flag.Args()[1:]))
+	}
+
 	if vFlag {
 		fmt.Println(helper.GetVersion())
 		//os.Exit(0)
@@ -35,7 +47,7 @@ func main() {
 		//os.Exit(0)
 	}
 
-	option.Load()
+	project.Load()
 
 	if val, ok := os.LookupEnv("PORT"); ok {
 		helper.Port, _ = strconv.Atoi(val) //字符串转化为int
@@ -47,9 +59,7 @@ func main() {
 		helper.StartBrowser("http://localhost:" + strconv.Itoa(helper.Port))
 	}
 
-	go serial.GrReceive()
-	go serial.GrTransmit()
-	go serial.GrRxPrase()
+	go serial.GrSubscribe()
 	go elffile.FileWatch()
 	server.Start(&fsys)
 }
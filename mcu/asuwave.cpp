@@ -55,7 +55,30 @@ enum ASUWAVE_ACT
   ASUWAVE_ACT_READ,
   ASUWAVE_ACT_READRETURN,
   ASUWAVE_ACT_WRITE,
-  ASUWAVE_ACT_WRITERETURN
+  ASUWAVE_ACT_WRITERETURN,
+  ASUWAVE_ACT_HELLO,
+  ASUWAVE_ACT_HELLORETURN,
+  ASUWAVE_ACT_SUBSCRIBEBATCH
+};
+
+/**
+ * @brief  protocol version definition
+ *         v2 frame: version, seq, v1 frame without '\n', crc16, '\n'
+ */
+enum ASUWAVE_VERSION
+{
+  ASUWAVE_VERSION_1 = 0x01,
+  ASUWAVE_VERSION_2
+};
+
+/**
+ * @brief  capability bits exchanged in hello, v2 only
+ *         batch frame: version, seq, board, act, count, tick,
+ *                      count * {addr, dataNum, data}, crc16, '\n'
+ */
+enum ASUWAVE_CAP
+{
+  ASUWAVE_CAP_BATCH = 0x01
 };
 
 /**
@@ -83,7 +106,8 @@ typedef struct
    This parameter can be any value of @ref ASUWAVE_ACT or @ref ASUWAVE_ERROR */
 
   uint8_t dataNum :8; /*!< Size amount of data to be operated.
-   This parameter must be a number between Min_Data = 0 and Max_Data = 8. */
+   This parameter must be a number between Min_Data = 0 and Max_Data = 8,
+   or up to ASUWAVE_MAX_DATANUM to subscribe when batch frames are accepted. */
 
   uint32_t addr :32; /*!< The address of MCU to be operated.
    This parameter must be a number between Min_Data = 0x20000000 and Max_Data = 0x80000000. */
@@ -144,6 +168,8 @@ typedef union
 
 /* definition of the list of address to read */
 #define MAX_ADDR_NUM 10
+/* a whole struct can be subscribed in batch frames, at most this long */
+#define ASUWAVE_MAX_DATANUM 64
 typedef struct
 {
   uint8_t dataNum;
@@ -151,15 +177,102 @@ typedef struct
 } list_addr_t;
 static list_addr_t list_addr[MAX_ADDR_NUM];
 
+/* protocol version in use, negotiated by the host, and sequence number of frames sent */
+static uint8_t version = ASUWAVE_VERSION_1;
+static uint8_t tx_seq = 0;
+
+/* capabilities accepted in hello */
+static uint8_t caps = 0;
+
 /* function prototypes -------------------------------------------------------*/
 
+/**
+ * @brief  CRC-16/CCITT-FALSE.
+ * @param  buff: data to check.
+ * @param  length: the length of data.
+ * @retval crc.
+ */
+uint16_t crc16(const uint8_t *buff, uint16_t length)
+{
+  uint16_t crc = 0xffff;
+  while (length--)
+  {
+    crc ^= (uint16_t) (*buff++) << 8;
+    for (int i = 0; i < 8; i++)
+      crc = (crc & 0x8000) ? (crc << 1) ^ 0x1021 : crc << 1;
+  }
+  return crc;
+}
+
+/**
+ * @brief  Pack a frame to send using SLIP, in the negotiated version.
+ * @param  asuwave_txu: asuwave data union to send.
+ * @retval the SLIP packet.
+ */
+std::vector<uint8_t> pack_frame(asuwave_txu_t *asuwave_txu)
+{
+  if (version != ASUWAVE_VERSION_2)
+    return SerialLineIP::Pack(asuwave_txu->buff, sizeof(asuwave_txu->buff));
+
+  uint8_t frame[sizeof(asuwave_txu->buff) + 4];
+  frame[0] = ASUWAVE_VERSION_2;
+  frame[1] = tx_seq++;
+  memcpy(frame + 2, asuwave_txu->buff, sizeof(asuwave_txu->buff) - 1);
+  uint16_t crc = crc16(frame, sizeof(frame) - 3);
+  frame[sizeof(frame) - 3] = crc & 0xff;
+  frame[sizeof(frame) - 2] = crc >> 8;
+  frame[sizeof(frame) - 1] = '\n';
+  return SerialLineIP::Pack(frame, sizeof(frame));
+}
+
+/**
+ * @brief  Pack all the subscribed variables into one batch frame using SLIP.
+ * @param  None
+ * @retval the SLIP packet.
+ */
+std::vector<uint8_t> pack_batch(void)
+{
+  static uint8_t frame[9 + MAX_ADDR_NUM * (5 + ASUWAVE_MAX_DATANUM) + 3];
+  uint16_t len = 9;
+  uint8_t count = 0;
+  uint32_t tick = getTick();
+
+  for (int i = 0; i < MAX_ADDR_NUM; i++)
+  {
+    if (list_addr[i].dataNum == 0) continue;
+    memcpy(frame + len, &list_addr[i].addr, 4);
+    frame[len + 4] = list_addr[i].dataNum;
+    /* Reads the variable in flash memory */
+    memcpy(frame + len + 5, (__IO uint8_t*) list_addr[i].addr, list_addr[i].dataNum);
+    len += 5 + list_addr[i].dataNum;
+    count++;
+  }
+
+  frame[0] = ASUWAVE_VERSION_2;
+  frame[1] = tx_seq++;
+  frame[2] = ASUWAVE_BOARD_1;
+  frame[3] = ASUWAVE_ACT_SUBSCRIBEBATCH;
+  frame[4] = count;
+  memcpy(frame + 5, &tick, 4);
+  uint16_t crc = crc16(frame, len);
+  frame[len++] = crc & 0xff;
+  frame[len++] = crc >> 8;
+  frame[len++] = '\n';
+  return SerialLineIP::Pack(frame, len);
+}
+
 /**
  * @brief  Register the address.
  * @param  asuwave_rxu: received asuwave data union.
- * @retval the index of the list_addr to register.
+ * @retval the index of the list_addr to register, -1 if full, -2 if too long.
  */
 int8_t addr_register(asuwave_rxu_t *asuwave_rxu)
 {
+  /* Values longer than 8 bytes only fit in batch frames */
+  uint8_t n = asuwave_rxu->body.dataNum;
+  if (n > ASUWAVE_MAX_DATANUM || (n > 8 && !(version == ASUWAVE_VERSION_2 && (caps & ASUWAVE_CAP_BATCH))))
+    return -2;
+
   for (int i = 0; i < MAX_ADDR_NUM; i++)
   {
     /* Find the index of list_addr that is null */
@@ -212,10 +325,13 @@ void return_err(asuwave_rxu_t *asuwave_rxu, uint8_t err)
   asuwave_txu.body.act = err;
   asuwave_txu.body.addr = asuwave_rxu->body.addr;
   asuwave_txu.body.dataNum = asuwave_rxu->body.dataNum;
+  asuwave_txu.body.tick = getTick();
   asuwave_txu.body.carriageReturn = '\n';
 
-  /* Send the error message */
-  HAL_UART_Transmit_DMA(huart_x, asuwave_txu.buff, 9);
+  /* Send the error message, packed the same way as the other replies */
+  static std::vector<uint8_t> tx_buff;
+  tx_buff = pack_frame(&asuwave_txu);
+  HAL_UART_Transmit_DMA(huart_x, &tx_buff[0], tx_buff.size());
 }
 
 /**
@@ -226,10 +342,19 @@ void return_err(asuwave_rxu_t *asuwave_rxu, uint8_t err)
 void asuwave_subscribe(void)
 {
   /* definition of the data pack and length to send */
-  std::vector<uint8_t> tx_buff;
+  static std::vector<uint8_t> tx_buff;
   static uint16_t tx_len = 0;
   static asuwave_txu_t asuwave_txu;
 
+  /* One frame for all variables if the host accepts */
+  if (version == ASUWAVE_VERSION_2 && (caps & ASUWAVE_CAP_BATCH))
+  {
+    tx_buff = pack_batch();
+    HAL_UART_Transmit_DMA(huart_x, &tx_buff[0], tx_buff.size());
+    return;
+  }
+  tx_buff.clear();
+
   /* Clear the data buffer to be sent */
   memset((uint8_t*) &asuwave_txu.buff, 0,
       sizeof(asuwave_txu.buff));
@@ -256,8 +381,8 @@ void asuwave_subscribe(void)
       asuwave_txu.body.dataNum = dataNum;
       asuwave_txu.body.tick = getTick();
       /* Pack using SLIP */
-      std::vector<uint8_t> packet = SerialLineIP::Pack(asuwave_txu.buff, 20);
-      tx_buff.insert(packet.begin(), packet.end());
+      std::vector<uint8_t> packet = pack_frame(&asuwave_txu);
+      tx_buff.insert(tx_buff.end(), packet.begin(), packet.end());
     }
   }
 
@@ -299,8 +424,51 @@ void write_flash(asuwave_rxu_t *asuwave_rxu)
       if (HAL_FLASH_Lock() == HAL_OK)
         asuwave_txu.body.act = ASUWAVE_ACT_WRITERETURN;
 
-  /* Send return data */
-  HAL_UART_Transmit_DMA(huart_x, asuwave_txu.buff, 8);
+  if (asuwave_txu.body.act != ASUWAVE_ACT_WRITERETURN)
+  {
+    return_err(asuwave_rxu, ASUWAVE_ERROR_NOSUCHADDR);
+    return;
+  }
+  asuwave_txu.body.tick = getTick();
+
+  /* Send return data, the host retries until it gets this */
+  static std::vector<uint8_t> tx_buff;
+  tx_buff = pack_frame(&asuwave_txu);
+  HAL_UART_Transmit_DMA(huart_x, &tx_buff[0], tx_buff.size());
+}
+
+/**
+ * @brief  Answer the hello from host and switch to protocol v2.
+ * @param  asuwave_rxu: received asuwave data union.
+ * @retval None
+ */
+void hello(asuwave_rxu_t *asuwave_rxu)
+{
+  asuwave_txu_t asuwave_txu;
+  memset((uint8_t*) &asuwave_txu.buff, 0,
+      sizeof(asuwave_txu.buff));
+
+  asuwave_txu.body.board = asuwave_rxu->body.board;
+  asuwave_txu.body.act = ASUWAVE_ACT_HELLORETURN;
+  asuwave_txu.body.tick = getTick();
+  asuwave_txu.body.carriageReturn = '\n';
+  /* The highest version both sides support, and the capabilities accepted */
+  asuwave_txu.buff[7] = ASUWAVE_VERSION_2;
+  asuwave_txu.buff[8] = (uint8_t) (asuwave_rxu->body.dataBuf >> 8) & ASUWAVE_CAP_BATCH;
+
+  /* Answer in v1, then use v2 */
+  version = ASUWAVE_VERSION_1;
+  caps = 0;
+  static std::vector<uint8_t> tx_buff;
+  tx_buff = pack_frame(&asuwave_txu);
+  HAL_UART_Transmit_DMA(huart_x, &tx_buff[0], tx_buff.size());
+
+  if ((uint8_t) asuwave_rxu->body.dataBuf >= ASUWAVE_VERSION_2)
+  {
+    version = ASUWAVE_VERSION_2;
+    tx_seq = 0;
+    caps = asuwave_txu.buff[8];
+  }
 }
 
 /**
@@ -312,8 +480,21 @@ void write_flash(asuwave_rxu_t *asuwave_rxu)
 uint32_t asuwave_callback(uint8_t *data_buf, uint16_t length)
 {
   asuwave_rxu_t asuwave_rxu;
-  if (length != sizeof(asuwave_rxu.buff)) return 1;
-  memcpy(&asuwave_rxu.buff, data_buf, length);
+  if (length == sizeof(asuwave_rxu.buff))
+  {
+    /* v1 frame */
+    memcpy(&asuwave_rxu.buff, data_buf, length);
+  }
+  else if (length == sizeof(asuwave_rxu.buff) + 4)
+  {
+    /* v2 frame: check version, terminator and crc, then strip them */
+    if (data_buf[0] != ASUWAVE_VERSION_2 || data_buf[length - 1] != '\n') return 1;
+    uint16_t crc = data_buf[length - 3] | (data_buf[length - 2] << 8);
+    if (crc != crc16(data_buf, length - 3)) return 1;
+    memcpy(&asuwave_rxu.buff, data_buf + 2, sizeof(asuwave_rxu.buff) - 1);
+    asuwave_rxu.body.carriageReturn = '\n';
+  }
+  else return 1;
 
   /* Check if it is a valid board ID */
   if (asuwave_rxu.body.board == ASUWAVE_BOARD_1)
@@ -323,8 +504,15 @@ uint32_t asuwave_callback(uint8_t *data_buf, uint16_t length)
     switch (asuwave_rxu.body.act)
     {
       case ASUWAVE_ACT_SUBSCRIBE:
-        if (addr_register(&asuwave_rxu) == -1)
-          return_err(&asuwave_rxu, ASUWAVE_ERROR_FULLADDR);
+        switch (addr_register(&asuwave_rxu))
+        {
+          case -1:
+            return_err(&asuwave_rxu, ASUWAVE_ERROR_FULLADDR);
+            break;
+          case -2:
+            return_err(&asuwave_rxu, ASUWAVE_ERROR_NOSUCHDATANUM);
+            break;
+        }
         break;
       case ASUWAVE_ACT_WRITE:
         write_flash(&asuwave_rxu);
@@ -333,6 +521,9 @@ uint32_t asuwave_callback(uint8_t *data_buf, uint16_t length)
         if (addr_unregister(&asuwave_rxu) == -1)
           return_err(&asuwave_rxu, ASUWAVE_ERROR_NOSUCHADDRREG);
         break;
+      case ASUWAVE_ACT_HELLO:
+        hello(&asuwave_rxu);
+        break;
       default:
         return_err(&asuwave_rxu, ASUWAVE_ERROR_NOSUCHACT);
         return 1;
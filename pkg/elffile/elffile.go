@@ -6,6 +6,7 @@ package elffile
 import (
 	"debug/dwarf"
 	"debug/elf"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -32,8 +33,8 @@ func Check(f *os.File) (*elf.File, error) {
 	}
 
 	// 此生无缘，转身离去
-	if eFile.FileHeader.Class != elf.ELFCLASS32 || eFile.FileHeader.Machine != elf.EM_ARM {
-		return nil, errors.New("not valid ELF")
+	if _, err := TargetOf(eFile.FileHeader); err != nil {
+		return nil, err
 	}
 
 	// 若是有缘，三生有幸
@@ -46,6 +47,12 @@ func ReadVariable(f *elf.File) (variable.Projs, error) {
 	// 排除一切杂念，听你娓娓道来
 	x := variable.Projs{}
 
+	// 你从哪里来
+	tg, err := TargetOf(f.FileHeader)
+	if err != nil {
+		return x, err
+	}
+
 	// 故事很长，从那一天说起吧
 	dwarfData, err := f.DWARF()
 	if err != nil {
@@ -53,6 +60,21 @@ func ReadVariable(f *elf.File) (variable.Projs, error) {
 	}
 	r := dwarfData.Reader()
 
+	// 日记里也记着你的住址
+	syms := symbols(f)
+
+	// 你常去的地方
+	ram := MemoryMap(f)
+
+	// 先许下的诺言，后来才兑现：声明的全名与类型
+	decls := map[dwarf.Offset]declT{}
+
+	// 走过的每一段路：文件、命名空间、函数、类
+	scopes := []scopeT{}
+
+	// 不同文件里同名的 static 变量，要冠上文件名才分得清
+	clash := clashes(dwarfData)
+
 	for {
 
 		// 不断倾诉你心底的声音
@@ -66,74 +88,345 @@ func ReadVariable(f *elf.File) (variable.Projs, error) {
 			return x, nil
 		}
 
+		// 一段路走完了
+		if entry.Tag == 0 {
+			if len(scopes) > 0 {
+				scopes = scopes[:len(scopes)-1]
+			}
+			continue
+		}
+
 		// 重要的回忆，怎能忘记
-		if entry.Tag == dwarf.TagVariable && !entry.Children {
-			y := variable.ProjT{}
-			var a uint32
+		if entry.Tag == dwarf.TagVariable || entry.Tag == dwarf.TagMember {
+			readEntry(tg, ram, dwarfData, entry, scopes, decls, clash, syms, &x)
+		}
 
-			// 探访你的住址
-			if v, ok := entry.Val(dwarf.AttrLocation).([]byte); ok {
-				if len(v) != 5 {
-					continue
-				}
-				a = variable.BytesToUint32(v[1:])
+		// 走进新的一段路
+		if entry.Children {
+			scopes = append(scopes, scopeOf(entry, scopes, decls))
+		}
+	}
+}
 
-				// 早已远去的人，只能放弃
-				if a < 0x20000000 || a >= 0x80000000 {
-					continue
-				}
+// 一段路的名字，以及是否在函数里
+type scopeT struct {
+	name   string
+	full   bool // 名字已是全名
+	inFunc bool
+	file   string // 编译单元的文件名
+}
 
-				y.Addr = fmt.Sprintf("0x%08x", a)
-			}
+// 声明里留下的全名、类型与链接名
+type declT struct {
+	name    string
+	typ     dwarf.Offset
+	linkage string
+}
 
-			// 呼喊着你的名字
-			if v, ok := entry.Val(dwarf.AttrName).(string); ok {
-				y.Name = v
-			}
+func scopeOf(entry *dwarf.Entry, scopes []scopeT, decls map[dwarf.Offset]declT) scopeT {
+	s := scopeT{}
+	switch entry.Tag {
+	case dwarf.TagCompileUnit:
+		s.file = fileName(entry)
+	case dwarf.TagNamespace, dwarf.TagClassType, dwarf.TagStructType, dwarf.TagUnionType:
+		s.name, _ = entry.Val(dwarf.AttrName).(string)
+	case dwarf.TagSubprogram:
+		s.inFunc = true
+		s.name, _ = entry.Val(dwarf.AttrName).(string)
+		if d, ok := decls[spec(entry)]; ok && s.name == "" {
+			s.name, s.full = d.name, true
+		}
+	}
+	if entry.Tag == dwarf.TagSubprogram && entry.Val(dwarf.AttrDeclaration) == true && s.name != "" {
+		decls[entry.Offset] = declT{name: qualify(scopes, s.name)}
+	}
+	return s
+}
 
-			// 尝试读懂你的心
-			if v, ok := entry.Val(dwarf.AttrType).(dwarf.Offset); ok {
-				t, err := dwarfData.Type(v)
+// 沿着走过的路呼喊你的全名，如 ns::var、func::var
+func qualify(scopes []scopeT, name string) string {
+	l := []string{}
+	for _, s := range scopes {
+		if s.full {
+			l = l[:0]
+		}
+		if s.name != "" {
+			l = append(l, s.name)
+		}
+	}
+	return strings.Join(append(l, name), "::")
+}
 
-				if err != nil {
-					continue
+// 编译单元的文件名，不要路径，如 chassis.c
+func fileName(entry *dwarf.Entry) string {
+	name, _ := entry.Val(dwarf.AttrName).(string)
+	return name[strings.LastIndexAny(name, `/\`)+1:]
+}
+
+// clashes 找出在不止一个文件里定义的文件作用域变量名
+func clashes(dwarfData *dwarf.Data) map[string]bool {
+	files := map[string]map[string]bool{}
+	r := dwarfData.Reader()
+	for {
+		cu, err := r.Next()
+		if err != nil || cu == nil {
+			break
+		}
+		if cu.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		if !cu.Children {
+			continue
+		}
+		file := fileName(cu)
+		for {
+			entry, err := r.Next()
+			if err != nil || entry == nil || entry.Tag == 0 {
+				break
+			}
+			if name, ok := entry.Val(dwarf.AttrName).(string); ok && entry.Tag == dwarf.TagVariable && entry.Val(dwarf.AttrDeclaration) != true {
+				if files[name] == nil {
+					files[name] = map[string]bool{}
 				}
+				files[name][file] = true
+			}
+			if entry.Children {
+				r.SkipChildren()
+			}
+		}
+	}
+	m := map[string]bool{}
+	for name, l := range files {
+		if len(l) > 1 {
+			m[name] = true
+		}
+	}
+	return m
+}
 
-				// 有时你的心难以琢磨
-				if s, ok := checkStruct(t); ok {
+func inFunc(scopes []scopeT) bool {
+	for _, s := range scopes {
+		if s.inFunc {
+			return true
+		}
+	}
+	return false
+}
 
-					// 尝试着一层一层地拨开
-					namePrefix := []string{y.Name}
-					dfsStruct(namePrefix, a, &x, s.Field)
+// 声明所在，定义与内联都指回这里
+func spec(entry *dwarf.Entry) dwarf.Offset {
+	if v, ok := entry.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+		return v
+	}
+	if v, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+		return v
+	}
+	return 0
+}
 
-				} else if ar, ok := checkArray(t); ok {
-					namePrefix := []string{y.Name}
-					dfsArray(namePrefix, a, &x, ar.Type, ar.Count)
-				} else {
+func linkageName(entry *dwarf.Entry) string {
+	if v, ok := entry.Val(dwarf.AttrLinkageName).(string); ok {
+		return v
+	}
+	if v, ok := entry.Val(attrMIPSLinkageName).(string); ok {
+		return v
+	}
+	return ""
+}
 
-					// 别用谎言欺骗自己
-					if _, ok := variable.TypeLen[t.String()]; !ok {
-						continue
-					}
+// 读懂一个变量
+func readEntry(tg TargetT, ram Regions, dwarfData *dwarf.Data, entry *dwarf.Entry, scopes []scopeT, decls map[dwarf.Offset]declT, clash map[string]bool, syms map[string]uint64, x *variable.Projs) {
+	y := variable.ProjT{}
+	var a uint32
+
+	// 呼喊着你的名字
+	d := declT{linkage: linkageName(entry)}
+	if v, ok := entry.Val(dwarf.AttrName).(string); ok {
+		d.name = qualify(scopes, v)
+		// 各个文件里都叫这个名字，static 的冠上文件名，如 chassis.c::count
+		if len(scopes) == 1 && clash[v] && entry.Val(dwarf.AttrExternal) != true {
+			d.name = scopes[0].file + "::" + v
+		}
+	}
+	if v, ok := entry.Val(dwarf.AttrType).(dwarf.Offset); ok {
+		d.typ = v
+	}
 
-					// 只想听听你真实的声音
-					y.Type = t.String()
-				}
-			}
+	// 只是许下诺言，等着以后兑现；若定义在没有调试信息的地方，只好去翻日记
+	if entry.Val(dwarf.AttrDeclaration) == true {
+		decls[entry.Offset] = d
+	} else if entry.Tag != dwarf.TagVariable {
+		return
+	}
 
-			// 那些小事，就让它消失在风里
-			if y.Addr == "" || y.Name == "" || y.Type == "" {
-				continue
+	// 兑现当初的诺言，名字与类型都在那里
+	if s, ok := decls[spec(entry)]; ok {
+		if d.name == "" {
+			d.name = s.name
+		}
+		if d.typ == 0 {
+			d.typ = s.typ
+		}
+		if d.linkage == "" {
+			d.linkage = s.linkage
+		}
+	}
+	y.Name = d.name
+
+	// 探访你的住址
+	addr, ok := locAddr(entry.Val(dwarf.AttrLocation), tg.AddrBytes)
+	if !ok {
+		// 局部变量住在栈上，寻不到
+		if _, has := entry.Val(dwarf.AttrLocation).([]byte); has || inFunc(scopes) {
+			return
+		}
+
+		// 翻开日记，按链接名或名字找
+		if addr, ok = syms[d.linkage]; !ok || d.linkage == "" {
+			if addr, ok = syms[d.name]; !ok {
+				return
 			}
+		}
+	}
+
+	// 早已远去的人，只能放弃
+	r, ok := ram.Find(addr)
+	if !ok {
+		return
+	}
+	y.Region = r.Name
+	a = uint32(addr)
+	y.Addr = fmt.Sprintf("0x%08x", a)
+
+	// 尝试读懂你的心
+	if d.typ == 0 {
+		return
+	}
+	t, err := dwarfData.Type(d.typ)
+	if err != nil {
+		return
+	}
+
+	// 有时你的心难以琢磨
+	if s, ok := checkStruct(t); ok {
+
+		// 尝试着一层一层地拨开
+		namePrefix := []string{y.Name}
+		dfsStruct(namePrefix, a, x, s.Field, ram)
+		addSnapshot(y.Name, a, t, x, ram)
+		return
+
+	} else if ar, ok := checkArray(t); ok {
+		namePrefix := []string{y.Name}
+		dfsArray(namePrefix, a, x, ar.Type, ar.Count, ram)
+		addSnapshot(y.Name, a, t, x, ram)
+		return
+
+	} else if p, ok := underlying(t).(*dwarf.PtrType); ok {
+
+		// 心里装着另一个人
+		addPointer(y, a, p, x)
+		return
+	}
+
+	// 别用谎言欺骗自己
+	s, ok := scalar(t)
+	if !ok {
+		return
+	}
+
+	// 只想听听你真实的声音
+	y.Type = s.Type
+	y.Enum = s.Enum
+
+	// 那些小事，就让它消失在风里
+	if y.Name == "" || y.Type == "" {
+		return
+	}
+
+	// 却总有些事，难以忘记
+	(*x)[y.Name] = y
+}
+
+// DW_OP_addr 之后是地址，长度随目标平台而定，也可能再加一个 DW_OP_plus_uconst 偏移
+func locAddr(v interface{}, size int) (uint64, bool) {
+	loc, ok := v.([]byte)
+	if !ok || len(loc) < 1 || loc[0] != dwarfOpAddr {
+		return 0, false
+	}
+	// 有的工具链不管 ELF 类别，只看长度
+	if len(loc) == 5 || len(loc) == 9 {
+		size = len(loc) - 1
+	}
+	if len(loc) < 1+size {
+		return 0, false
+	}
+	var a uint64
+	if size == 8 {
+		a = binary.LittleEndian.Uint64(loc[1:9])
+	} else {
+		a = uint64(binary.LittleEndian.Uint32(loc[1:5]))
+	}
 
-			// 却总有些事，难以忘记
-			x[y.Name] = y
+	rest := loc[1+size:]
+	if len(rest) == 0 {
+		return a, true
+	}
+	if rest[0] != dwarfOpPlusUconst {
+		return 0, false
+	}
+	off, n := uleb128(rest[1:])
+	if n == 0 || 1+n != len(rest) {
+		return 0, false
+	}
+	return a + off, true
+}
+
+const (
+	attrMIPSLinkageName dwarf.Attr = 0x2007
+
+	dwarfOpAddr       = 0x03
+	dwarfOpPlusUconst = 0x23
+)
+
+// 返回值与读过的字节数，不完整时读过 0 字节
+func uleb128(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i >= 10 {
+			break
+		}
+		v |= uint64(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			return v, i + 1
 		}
 	}
+	return 0, 0
+}
+
+// 符号表里的数据对象，名字到地址
+func symbols(f *elf.File) map[string]uint64 {
+	m := map[string]uint64{}
+	l, err := f.Symbols()
+	if err != nil {
+		return m
+	}
+	for _, s := range l {
+		t := elf.ST_TYPE(s.Info)
+		if s.Name == "" || s.Value == 0 || (t != elf.STT_OBJECT && t != elf.STT_NOTYPE) {
+			continue
+		}
+		if s.Section == elf.SHN_UNDEF {
+			continue
+		}
+		m[s.Name] = s.Value
+	}
+	return m
 }
 
 // 一层一层地拨开你的心
-func dfsStruct(namePrefix []string, addrPrefix uint32, x *variable.Projs, s []*dwarf.StructField) {
+func dfsStruct(namePrefix []string, addrPrefix uint32, x *variable.Projs, s []*dwarf.StructField, ram Regions) {
 
 	// 不愿放过每一个问题
 	for _, v := range s {
@@ -146,7 +439,8 @@ func dfsStruct(namePrefix []string, addrPrefix uint32, x *variable.Projs, s []*d
 			addrPrefix = addrPrefix + uint32(v.ByteOffset)
 
 			// 勇敢地接着走下去
-			dfsStruct(namePrefix, addrPrefix, x, st.Field)
+			dfsStruct(namePrefix, addrPrefix, x, st.Field, ram)
+			addSnapshot(strings.Join(namePrefix, "."), addrPrefix, v.Type, x, ram)
 
 			// 回到路口，准备下一次的旅程
 			namePrefix = namePrefix[:len(namePrefix)-1]
@@ -155,85 +449,285 @@ func dfsStruct(namePrefix []string, addrPrefix uint32, x *variable.Projs, s []*d
 		} else if a, ok := checkArray(v.Type); ok {
 			namePrefix = append(namePrefix, v.Name)
 			addrPrefix = addrPrefix + uint32(v.ByteOffset)
-			dfsArray(namePrefix, addrPrefix, x, a.Type, a.Count)
+			dfsArray(namePrefix, addrPrefix, x, a.Type, a.Count, ram)
+			addSnapshot(strings.Join(namePrefix, "."), addrPrefix, v.Type, x, ram)
 			namePrefix = namePrefix[:len(namePrefix)-1]
 			addrPrefix = addrPrefix - uint32(v.ByteOffset)
 		} else {
 
 			// 终于，你缓缓开口
-			a := addrPrefix + uint32(v.ByteOffset)
-			if a < 0x20000000 || a >= 0x80000000 {
+			y, ok := scalar(v.Type)
+			if !ok {
 				continue
 			}
-			t := v.Type.String()
-			if _, ok := variable.TypeLen[t]; !ok {
+			off := v.ByteOffset
+			if v.BitSize != 0 {
+				// 欲言又止，只说了几个字
+				if off, y.BitOffset, ok = bitPos(v, variable.TypeLen[y.Type]); !ok {
+					continue
+				}
+				y.BitSize = int(v.BitSize)
+			}
+			a := addrPrefix + uint32(off)
+			r, ok := ram.Find(uint64(a))
+			if !ok {
 				continue
 			}
 
 			// 道出心底的秘密
-			name := strings.Join(namePrefix, ".") + "." + v.Name
-			(*x)[name] = variable.ProjT{
-				Name: name,
-				Addr: fmt.Sprintf("0x%08x", a),
-				Type: v.Type.String(),
-			}
+			y.Name = strings.Join(namePrefix, ".") + "." + v.Name
+			y.Addr = fmt.Sprintf("0x%08x", a)
+			y.Region = r.Name
+			(*x)[y.Name] = y
 		}
 	}
 }
 
-// 寂静来袭
-func checkStruct(t dwarf.Type) (*dwarf.StructType, bool) {
+// 心里装着另一个人：指针本身，以及经由它找到的变量，如 p->speed、*p
+func addPointer(y variable.ProjT, addr uint32, p *dwarf.PtrType, x *variable.Projs) {
+	size := int(p.Size())
+	switch size {
+	case 4:
+		y.Type = "uint32_t"
+	case 8:
+		y.Type = "uint64_t"
+	default:
+		return
+	}
+	y.Pointee = "void"
+	if p.Type != nil {
+		y.Pointee = p.Type.String()
+	}
+	if y.Name == "" {
+		return
+	}
+	(*x)[y.Name] = y
+	if p.Type == nil {
+		return
+	}
 
-	// 说点什么吧
-	if s, ok := t.(*dwarf.StructType); ok {
-		return s, true
+	// 借 dfs 走一遍，地址从 0 数起便是偏移
+	z := variable.Projs{}
+	all := Regions{{Start: 0, End: 0x100000000}}
+	if s, ok := checkStruct(p.Type); ok {
+		dfsStruct([]string{y.Name}, 0, &z, s.Field, all)
+		addSnapshot(y.Name, 0, p.Type, &z, all)
+	} else if s, ok := scalar(p.Type); ok {
+		s.Addr = "0x00000000"
+		z[y.Name] = s
+	}
+	for n, q := range z {
+		off, err := strconv.ParseUint(q.Addr, 0, 32)
+		if err != nil {
+			continue
+		}
+		if n == y.Name {
+			q.Name = "*" + y.Name
+		} else {
+			q.Name = y.Name + "->" + strings.TrimPrefix(n, y.Name+".")
+		}
+		q.Addr = y.Addr
+		q.Region = ""
+		q.Ptr = &variable.PtrT{Addr: addr, Size: size, Offset: int(off)}
+		(*x)[q.Name] = q
 	}
+}
+
+// 想把你整个拥入怀中：不超过 MaxLen 的结构体或数组，成员来自同一时刻
+func addSnapshot(name string, addr uint32, t dwarf.Type, x *variable.Projs, ram Regions) {
+	if t.Size() <= 0 || t.Size() > variable.MaxLen {
+		return
+	}
+
+	// 借 dfs 走一遍，记下每个成员的偏移
+	y := variable.Projs{}
+	if s, ok := checkStruct(t); ok {
+		dfsStruct([]string{name}, addr, &y, s.Field, ram)
+	} else if a, ok := checkArray(t); ok {
+		dfsArray([]string{name}, addr, &y, a.Type, a.Count, ram)
+	}
+	fields := []variable.FieldT{}
+	for n, p := range y {
+		a, err := strconv.ParseUint(p.Addr, 0, 32)
+		if err != nil || len(p.Fields) != 0 {
+			continue
+		}
+		fields = append(fields, variable.FieldT{
+			Name:      strings.TrimPrefix(n, name+"."),
+			Offset:    int(uint32(a) - addr),
+			Type:      p.Type,
+			BitOffset: p.BitOffset,
+			BitSize:   p.BitSize,
+		})
+	}
+	if len(fields) == 0 {
+		return
+	}
+	variable.SortFields(fields)
+	r, _ := ram.Find(uint64(addr))
+
+	(*x)[name] = variable.ProjT{
+		Name:   name,
+		Addr:   fmt.Sprintf("0x%08x", addr),
+		Type:   t.String(),
+		Fields: fields,
+		Region: r.Name,
+	}
+}
+
+// 听懂你的每一句话：认得的基本类型，或是枚举
+func scalar(t dwarf.Type) (variable.ProjT, bool) {
+	u := underlying(t)
+	if e, ok := u.(*dwarf.EnumType); ok {
+		return enumProj(e)
+	}
+	if n, ok := baseName(u); ok {
+		return variable.ProjT{Type: n}, true
+	}
+	if _, ok := variable.TypeLen[t.String()]; !ok {
+		return variable.ProjT{}, false
+	}
+	return variable.ProjT{Type: t.String()}, true
+}
 
-	// 不愿就此放弃
-	if td, ok := t.(*dwarf.TypedefType); ok {
-		if s, ok := td.Type.(*dwarf.StructType); ok {
-			return s, true
+// 拨开层层伪装：typedef 一层套一层，还有 const 和 volatile
+func underlying(t dwarf.Type) dwarf.Type {
+	for i := 0; i < 64; i++ {
+		switch u := t.(type) {
+		case *dwarf.TypedefType:
+			t = u.Type
+		case *dwarf.QualType:
+			t = u.Type
+		default:
+			return t
 		}
 	}
+	return t
+}
+
+// 不论叫什么名字，按编码和长度认出你本来的样子
+func baseName(t dwarf.Type) (string, bool) {
+	var n string
+	switch t.(type) {
+	case *dwarf.FloatType:
+		switch t.Size() {
+		case 4:
+			n = "float"
+		case 8:
+			n = "double"
+		}
+	case *dwarf.IntType, *dwarf.CharType:
+		n = fmt.Sprintf("int%d_t", t.Size()*8)
+	case *dwarf.UintType, *dwarf.UcharType:
+		n = fmt.Sprintf("uint%d_t", t.Size()*8)
+	case *dwarf.BoolType:
+		if t.Size() == 1 {
+			n = "bool"
+		}
+	}
+	if l, ok := variable.TypeLen[n]; !ok || int64(l) != t.Size() {
+		return "", false
+	}
+	return n, true
+}
+
+// 枚举按长度当作整数，取值都记下来
+func enumProj(e *dwarf.EnumType) (variable.ProjT, bool) {
+	y := variable.ProjT{}
+	signed := false
+	for _, v := range e.Val {
+		y.Enum = append(y.Enum, variable.EnumT{Name: v.Name, Value: v.Val})
+		signed = signed || v.Val < 0
+	}
+	switch e.ByteSize {
+	case 1, 2, 4, 8:
+	default:
+		return y, false
+	}
+	y.Type = fmt.Sprintf("int%d_t", e.ByteSize*8)
+	if !signed {
+		y.Type = "u" + y.Type
+	}
+	return y, true
+}
+
+// 位域所在存储单元相对于结构体的偏移，以及在存储单元中从最低位数起的位置，只管小端
+func bitPos(f *dwarf.StructField, n int) (int64, int, bool) {
+	unit := int64(n) * 8
+	if unit == 0 {
+		return 0, 0, false
+	}
+	if f.ByteSize != 0 || f.BitOffset != 0 {
+		// DWARF 2/3：从存储单元的最高位数起
+		if f.ByteSize != 0 {
+			unit = f.ByteSize * 8
+		}
+		bit := unit - f.BitOffset - f.BitSize
+		if bit < 0 || unit != int64(n)*8 {
+			return 0, 0, false
+		}
+		return f.ByteOffset, int(bit), true
+	}
+
+	// DWARF 4 以后：从结构体开头数起，找出对齐的存储单元，跨过了就从所在字节数起
+	start := f.DataBitOffset / unit * int64(n)
+	bit := f.DataBitOffset - start*8
+	if bit+f.BitSize > unit {
+		start = f.DataBitOffset / 8
+		bit = f.DataBitOffset % 8
+	}
+	if bit+f.BitSize > unit {
+		return 0, 0, false
+	}
+	return start, int(bit), true
+}
+
+// 寂静来袭
+func checkStruct(t dwarf.Type) (*dwarf.StructType, bool) {
+
+	// 说点什么吧，不愿被层层伪装挡住
+	if s, ok := underlying(t).(*dwarf.StructType); ok {
+		return s, true
+	}
 
 	// 最终仍是沉默
 	return nil, false
 }
 
-func dfsArray(namePrefix []string, addrPrefix uint32, x *variable.Projs, t dwarf.Type, c int64) {
+func dfsArray(namePrefix []string, addrPrefix uint32, x *variable.Projs, t dwarf.Type, c int64, ram Regions) {
 
 	for i := int64(0); i < c; i++ {
 		if st, ok := checkStruct(t); ok {
 			namePrefix = append(namePrefix, "["+strconv.FormatInt(i, 10)+"]")
-			dfsStruct(namePrefix, addrPrefix, x, st.Field)
+			dfsStruct(namePrefix, addrPrefix, x, st.Field, ram)
+			addSnapshot(strings.Join(namePrefix, "."), addrPrefix, t, x, ram)
 			namePrefix = namePrefix[:len(namePrefix)-1]
 		} else if a, ok := checkArray(t); ok {
 			namePrefix = append(namePrefix, "["+strconv.FormatInt(i, 10)+"]")
-			dfsArray(namePrefix, addrPrefix, x, a.Type, a.Count)
+			dfsArray(namePrefix, addrPrefix, x, a.Type, a.Count, ram)
 			namePrefix = namePrefix[:len(namePrefix)-1]
 		} else {
 			a := addrPrefix
-			if a < 0x20000000 || a >= 0x80000000 {
+			r, ok := ram.Find(uint64(a))
+			if !ok {
 				continue
 			}
-			t := t.String()
-			if _, ok := variable.TypeLen[t]; !ok {
+			y, ok := scalar(t)
+			if !ok {
 				continue
 			}
 
-			name := strings.Join(namePrefix, ".") + ".[" + strconv.FormatInt(i, 10) + "]"
-			(*x)[name] = variable.ProjT{
-				Name: name,
-				Addr: fmt.Sprintf("0x%08x", a),
-				Type: t,
-			}
+			y.Name = strings.Join(namePrefix, ".") + ".[" + strconv.FormatInt(i, 10) + "]"
+			y.Addr = fmt.Sprintf("0x%08x", a)
+			y.Region = r.Name
+			(*x)[y.Name] = y
 		}
 		addrPrefix = addrPrefix + uint32(t.Size())
 	}
 }
 
 func checkArray(t dwarf.Type) (*dwarf.ArrayType, bool) {
-	if a, ok := t.(*dwarf.ArrayType); ok {
+	if a, ok := underlying(t).(*dwarf.ArrayType); ok {
 		if a.Count != -1 {
 			return a, true
 		}
@@ -0,0 +1,361 @@
+package elffile
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+func TestBitPos(t *testing.T) {
+	cases := []struct {
+		name string
+		f    dwarf.StructField
+		n    int
+		off  int64
+		bit  int
+		ok   bool
+	}{
+		// DWARF 4：从结构体开头数起
+		{"data bit offset", dwarf.StructField{DataBitOffset: 42, BitSize: 20}, 4, 4, 10, true},
+		{"straddle", dwarf.StructField{DataBitOffset: 30, BitSize: 4}, 4, 3, 6, true},
+		// DWARF 2/3：从存储单元的最高位数起
+		{"bit offset", dwarf.StructField{ByteOffset: 4, ByteSize: 4, BitOffset: 24, BitSize: 5}, 4, 4, 3, true},
+		{"too wide", dwarf.StructField{DataBitOffset: 7, BitSize: 30}, 4, 0, 0, false},
+	}
+	for _, c := range cases {
+		off, bit, ok := bitPos(&c.f, c.n)
+		if ok != c.ok || ok && (off != c.off || bit != c.bit) {
+			t.Errorf("%s: bitPos = %d, %d, %v, want %d, %d, %v", c.name, off, bit, ok, c.off, c.bit, c.ok)
+		}
+	}
+}
+
+func TestScalar(t *testing.T) {
+	e := &dwarf.EnumType{
+		CommonType: dwarf.CommonType{ByteSize: 1},
+		EnumName:   "state",
+		Val:        []*dwarf.EnumValue{{Name: "IDLE", Val: 0}, {Name: "FAULT", Val: -1}},
+	}
+	td := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "state_t"}, Type: e}
+	y, ok := scalar(td)
+	if !ok || y.Type != "int8_t" || len(y.Enum) != 2 || y.Enum[1].Name != "FAULT" {
+		t.Errorf("enum: %+v %v", y, ok)
+	}
+
+	b := &dwarf.BoolType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "_Bool"}}}
+	if y, ok := scalar(b); !ok || y.Type != "bool" {
+		t.Errorf("bool: %+v %v", y, ok)
+	}
+}
+
+func TestUnderlying(t *testing.T) {
+	// volatile real_t，real_t -> fp32 -> float
+	f := &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "float"}}}
+	fp32 := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "fp32", ByteSize: 4}, Type: f}
+	real := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "real_t", ByteSize: 4}, Type: fp32}
+	v := &dwarf.QualType{Qual: "volatile", Type: real}
+	if y, ok := scalar(v); !ok || y.Type != "float" {
+		t.Errorf("volatile real_t: %+v %v", y, ok)
+	}
+
+	// 名字不同，按编码和长度认
+	short := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 2, Name: "short int"}}}
+	if y, ok := scalar(short); !ok || y.Type != "int16_t" {
+		t.Errorf("short int: %+v %v", y, ok)
+	}
+	ld := &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 12, Name: "long double"}}}
+	if y, ok := scalar(ld); ok {
+		t.Errorf("long double accepted: %+v", y)
+	}
+
+	// 套了两层 typedef 的结构体
+	s := &dwarf.StructType{StructName: "pt", Kind: "struct"}
+	pt := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "pt_t"}, Type: s}
+	point := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "point"}, Type: pt}
+	if st, ok := checkStruct(&dwarf.QualType{Qual: "const", Type: point}); !ok || st != s {
+		t.Errorf("typedef chain not followed")
+	}
+}
+
+func TestLocAddr(t *testing.T) {
+	cases := []struct {
+		name string
+		loc  interface{}
+		size int
+		addr uint64
+		ok   bool
+	}{
+		{"addr4", []byte{0x03, 0x10, 0x00, 0x00, 0x20}, 4, 0x20000010, true},
+		{"addr8 in elf32", []byte{0x03, 0x10, 0x00, 0x00, 0x20, 0, 0, 0, 0}, 4, 0x20000010, true},
+		{"plus uconst", []byte{0x03, 0x00, 0x00, 0x00, 0x20, 0x23, 0x80, 0x01}, 4, 0x20000080, true},
+		{"fbreg", []byte{0x91, 0x7c}, 4, 0, false},
+		{"short", []byte{0x03, 0x00, 0x00}, 4, 0, false},
+		{"loclist", int64(12), 4, 0, false},
+		{"stack value", []byte{0x03, 0x00, 0x00, 0x00, 0x20, 0x9f}, 4, 0, false},
+	}
+	for _, c := range cases {
+		a, ok := locAddr(c.loc, c.size)
+		if ok != c.ok || a != c.addr {
+			t.Errorf("%s: locAddr = %#x, %v, want %#x, %v", c.name, a, ok, c.addr, c.ok)
+		}
+	}
+}
+
+func TestQualify(t *testing.T) {
+	scopes := []scopeT{{}, {name: "ns"}, {name: "Cls::f", full: true, inFunc: true}, {}}
+	if n := qualify(scopes, "calls"); n != "Cls::f::calls" {
+		t.Errorf("qualify = %s", n)
+	}
+	if n := qualify(scopes[:2], "speed"); n != "ns::speed" {
+		t.Errorf("qualify = %s", n)
+	}
+	if !inFunc(scopes) || inFunc(scopes[:2]) {
+		t.Errorf("inFunc wrong")
+	}
+}
+
+func TestTargetOf(t *testing.T) {
+	cases := []struct {
+		class   elf.Class
+		machine elf.Machine
+		name    string
+	}{
+		{elf.ELFCLASS32, elf.EM_ARM, "ARM Cortex-M"},
+		{elf.ELFCLASS32, elf.EM_RISCV, "RISC-V 32"},
+		{elf.ELFCLASS64, elf.EM_X86_64, "x86-64 SIL"},
+		{elf.ELFCLASS64, elf.EM_ARM, ""},
+		{elf.ELFCLASS32, elf.EM_386, ""},
+	}
+	for _, c := range cases {
+		tg, err := TargetOf(elf.FileHeader{Class: c.class, Machine: c.machine})
+		if tg.Name != c.name || (err == nil) != (c.name != "") {
+			t.Errorf("%v %v: TargetOf = %q, %v", c.class, c.machine, tg.Name, err)
+		}
+	}
+
+	ram := Targets[1].RAM
+	if r, ok := ram.Find(0x3FC90000); !ok || r.Name != "DRAM" {
+		t.Errorf("Find = %+v, %v", r, ok)
+	}
+	if _, ok := Targets[2].RAM.Find(0x100000000); ok {
+		t.Errorf("address beyond 32 bits found")
+	}
+}
+
+func TestMemoryMap(t *testing.T) {
+	sec := func(name string, flags elf.SectionFlag, addr, size uint64) *elf.Section {
+		return &elf.Section{SectionHeader: elf.SectionHeader{Name: name, Flags: flags, Addr: addr, Size: size}}
+	}
+	f := &elf.File{
+		FileHeader: elf.FileHeader{Class: elf.ELFCLASS32, Machine: elf.EM_ARM},
+		Sections: []*elf.Section{
+			sec(".text", elf.SHF_ALLOC|elf.SHF_EXECINSTR, 0x08000000, 0x1000),
+			sec(".ccmram", elf.SHF_ALLOC|elf.SHF_WRITE, 0x10000000, 0x100),
+			sec(".data", elf.SHF_ALLOC|elf.SHF_WRITE, 0x20000000, 0x10),
+			sec(".bss", elf.SHF_ALLOC|elf.SHF_WRITE, 0x20000010, 0x20),
+			sec(".debug_info", 0, 0, 0x100),
+		},
+	}
+	l := MemoryMap(f)
+	if len(l) != 3 || l[0].Name != ".ccmram" || l[2].End != 0x20000030 {
+		t.Fatalf("MemoryMap = %+v", l)
+	}
+	// 只读的话 .text 里的常量也算
+	r := ReadableMap(f)
+	if len(r) != 4 || r[0].Name != ".text" {
+		t.Fatalf("ReadableMap = %+v", r)
+	}
+
+	// 没有节头时看 PT_LOAD 段
+	f.Sections = nil
+	f.Progs = []*elf.Prog{
+		{ProgHeader: elf.ProgHeader{Type: elf.PT_LOAD, Flags: elf.PF_R | elf.PF_X, Vaddr: 0x08000000, Memsz: 0x1000}},
+		{ProgHeader: elf.ProgHeader{Type: elf.PT_LOAD, Flags: elf.PF_R | elf.PF_W, Vaddr: 0x24000000, Memsz: 0x80}},
+	}
+	if l := MemoryMap(f); len(l) != 1 || l[0].Name != "LOAD1" || l[0].Start != 0x24000000 {
+		t.Errorf("MemoryMap = %+v", l)
+	}
+
+	// 什么都没有就用目标平台的
+	f.Progs = nil
+	if l := MemoryMap(f); len(l) != 1 || l[0].Name != "SRAM" {
+		t.Errorf("MemoryMap = %+v", l)
+	}
+
+	SetMemoryMap(variable.Board1, l)
+	SetReadableMap(variable.Board1, r)
+	defer ClearMemoryMap()
+	cases := []struct {
+		addr     uint64
+		n        int
+		ok, read bool
+	}{
+		{0x10000000, 4, true, true},
+		{0x2000000c, 4, true, true},
+		{0x2000000e, 4, false, false}, // .data 与 .bss 虽然相连，变量却不会跨在两节上
+		{0x2000002e, 4, false, false},
+		{0x08000000, 4, false, true},
+		{0x08000ffe, 4, false, false},
+	}
+	for _, c := range cases {
+		if _, err := CheckAddr(variable.Board1, c.addr, c.n); (err == nil) != c.ok {
+			t.Errorf("CheckAddr(%#x, %d) = %v", c.addr, c.n, err)
+		}
+		if _, err := CheckReadAddr(variable.Board1, c.addr, c.n); (err == nil) != c.read {
+			t.Errorf("CheckReadAddr(%#x, %d) = %v", c.addr, c.n, err)
+		}
+	}
+
+	// 别的板子没有载入工程文件，沿用原来的地址范围
+	if _, err := CheckAddr(variable.Board2, 0x08000000, 4); err != nil {
+		t.Errorf("CheckAddr board 2 = %v", err)
+	}
+}
+
+func TestAddPointer(t *testing.T) {
+	f32 := &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "float"}}}
+	i32 := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "int"}}}
+	s := &dwarf.StructType{
+		CommonType: dwarf.CommonType{ByteSize: 8},
+		StructName: "chassis",
+		Kind:       "struct",
+		Field:      []*dwarf.StructField{{Name: "speed", Type: f32}, {Name: "mode", Type: i32, ByteOffset: 4}},
+	}
+	td := &dwarf.TypedefType{CommonType: dwarf.CommonType{Name: "chassis_t", ByteSize: 8}, Type: s}
+	p := &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 4}, Type: td}
+
+	x := variable.Projs{}
+	addPointer(variable.ProjT{Name: "g_chassis", Addr: "0x20000010", Region: ".data"}, 0x20000010, p, &x)
+	if y := x["g_chassis"]; y.Type != "uint32_t" || y.Pointee != "chassis_t" || y.Ptr != nil {
+		t.Errorf("pointer %+v", y)
+	}
+	y := x["g_chassis->mode"]
+	if y.Type != "int32_t" || y.Addr != "0x20000010" || y.Region != "" || y.Ptr == nil || *y.Ptr != (variable.PtrT{Addr: 0x20000010, Size: 4, Offset: 4}) {
+		t.Errorf("member %+v", y)
+	}
+	if y := x["*g_chassis"]; len(y.Fields) != 2 || y.Ptr == nil || y.Ptr.Offset != 0 {
+		t.Errorf("snapshot %+v", y)
+	}
+
+	// void * 只有指针本身
+	x = variable.Projs{}
+	addPointer(variable.ProjT{Name: "pv", Addr: "0x20000020"}, 0x20000020, &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 4}}, &x)
+	if len(x) != 1 || x["pv"].Pointee != "void" {
+		t.Errorf("void pointer %+v", x)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer RemoveWathcer()
+	Watch(variable.Board1, "a.axf")
+	Watch(variable.AllBoards, "b.axf")
+	Watch(variable.Board1, "c.axf") // 同一块板子换一个文件
+	Watch(variable.Board2, "b.axf")
+	want := []WatchT{{variable.AllBoards, "b.axf"}, {variable.Board1, "c.axf"}, {variable.Board2, "b.axf"}}
+	if l := GetWatchList(); !reflect.DeepEqual(l, want) {
+		t.Errorf("GetWatchList = %v, want %v", l, want)
+	}
+	if l := boardsOf("b.axf"); !reflect.DeepEqual(l, []uint8{variable.AllBoards, variable.Board2}) {
+		t.Errorf("boardsOf = %v", l)
+	}
+
+	Unwatch(variable.AllBoards)
+	if l := GetWatchList(); len(l) != 2 || l[0].Board != variable.Board1 {
+		t.Errorf("Unwatch: %v", l)
+	}
+	RemoveWathcer()
+	if l := GetWatchList(); len(l) != 0 {
+		t.Errorf("RemoveWathcer: %v", l)
+	}
+}
+
+func TestUnload(t *testing.T) {
+	defer UnloadAll()
+	r := Regions{{Name: ".bss", Start: 0x30000000, End: 0x30000100}}
+	for _, b := range []uint8{variable.Board1, variable.Board2} {
+		variable.SetAllProj(b, variable.Projs{"a": {Name: "a", Addr: "0x30000000", Type: "int"}})
+		SetMemoryMap(b, r)
+		Watch(b, "a.axf")
+	}
+
+	if _, err := CheckAddr(variable.Board1, 0x08000000, 4); err == nil {
+		t.Errorf("memory map of board 1 not loaded")
+	}
+
+	// 只卸下板子 1 的，板子 2 的还在
+	if err := Unload(variable.Board1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := variable.GetProj(variable.Board1, "a"); ok {
+		t.Errorf("projs of board 1 left")
+	}
+	if _, err := CheckAddr(variable.Board1, 0x08000000, 4); err != nil {
+		t.Errorf("memory map of board 1 left: %v", err)
+	}
+	if l := GetWatchList(); len(l) != 1 || l[0].Board != variable.Board2 {
+		t.Errorf("watch list %v", l)
+	}
+	if _, ok := variable.GetProj(variable.Board2, "a"); !ok {
+		t.Errorf("projs of board 2 lost")
+	}
+	if _, err := CheckAddr(variable.Board2, 0x30000000, 4); err != nil {
+		t.Errorf("memory map of board 2 lost: %v", err)
+	}
+
+	if err := UnloadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := variable.GetProj(variable.Board2, "a"); ok || len(GetWatchList()) != 0 {
+		t.Errorf("board 2 left after UnloadAll")
+	}
+}
+
+// testdata/fixture.elf 由同目录下的两个文件编译而成：
+//
+//	gcc -g -O0 -nostdlib -static -fno-asynchronous-unwind-tables -fno-pie -no-pie \
+//	  -Wl,--entry=main -Wl,--build-id=none -o fixture.elf chassis.c gimbal.c
+//
+// objcopy --remove-section .comment fixture.elf
+func TestReadVariableFixture(t *testing.T) {
+	file, err := os.Open("testdata/fixture.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	f, err := Check(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := ReadVariable(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"speed":               "int32_t",
+		"g_pos.x":             "float",
+		"g_pos.y":             "int32_t",
+		"chassis_step::calls": "int32_t", // 函数里的 static
+		"chassis.c::count":    "int32_t", // 两个文件里都有 count
+		"gimbal.c::count":     "int32_t",
+		"yaw":                 "float", // 只有一个文件里有，不必冠上文件名
+	}
+	for name, typ := range want {
+		if y, ok := x[name]; !ok || y.Type != typ {
+			t.Errorf("%s = %+v, %v", name, y, ok)
+		}
+	}
+	if _, ok := x["count"]; ok {
+		t.Errorf("count not qualified")
+	}
+	if x["chassis.c::count"].Addr == x["gimbal.c::count"].Addr {
+		t.Errorf("both count at %s", x["gimbal.c::count"].Addr)
+	}
+	if len(x["g_pos"].Fields) != 2 {
+		t.Errorf("snapshot g_pos = %+v", x["g_pos"])
+	}
+}
@@ -0,0 +1,132 @@
+package elffile
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/scutrobotlab/asuwave/internal/variable"
+)
+
+// 从节头中找出可写的内存：.data、.bss 以及自定义的节，如 .ccmram、.dtcm
+// 没有节头时看可写的 PT_LOAD 段，都没有就用目标平台的内存区域
+func MemoryMap(f *elf.File) Regions {
+	return regionsOf(f, true)
+}
+
+// 从节头中找出读得到的内存：可写的之外还有 .text、.rodata 中的常量；
+// 没有节头时看所有的 PT_LOAD 段，都没有就用目标平台的内存区域
+func ReadableMap(f *elf.File) Regions {
+	return regionsOf(f, false)
+}
+
+func regionsOf(f *elf.File, write bool) Regions {
+	l := Regions{}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC == 0 || write && s.Flags&elf.SHF_WRITE == 0 || s.Flags&elf.SHF_TLS != 0 || s.Size == 0 {
+			continue
+		}
+		l = append(l, RegionT{Name: s.Name, Start: s.Addr, End: s.Addr + s.Size})
+	}
+	if len(l) != 0 {
+		return l
+	}
+
+	for i, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || write && p.Flags&elf.PF_W == 0 || p.Memsz == 0 {
+			continue
+		}
+		l = append(l, RegionT{Name: fmt.Sprintf("LOAD%d", i), Start: p.Vaddr, End: p.Vaddr + p.Memsz})
+	}
+	if len(l) != 0 {
+		return l
+	}
+
+	t, _ := TargetOf(f.FileHeader)
+	return t.RAM
+}
+
+// 未载入工程文件时，沿用原来的地址范围
+var defaultMap = Regions{{Start: 0, End: 0x80000000}}
+
+// 各块电路板的工程文件的内存分布，m 是可写的，r 是读得到的
+var memMap = struct {
+	sync.RWMutex
+	m map[uint8]Regions
+	r map[uint8]Regions
+}{m: make(map[uint8]Regions), r: make(map[uint8]Regions)}
+
+var ErrAddrOutOfRange = errors.New("address out of range")
+
+// SetMemoryMap 设置电路板可写的内存分布，空的则卸下
+func SetMemoryMap(board uint8, l Regions) {
+	setMap(memMap.m, board, l)
+}
+
+// SetReadableMap 设置电路板读得到的内存分布，空的则卸下
+func SetReadableMap(board uint8, l Regions) {
+	setMap(memMap.r, board, l)
+}
+
+func setMap(m map[uint8]Regions, board uint8, l Regions) {
+	memMap.Lock()
+	defer memMap.Unlock()
+	if len(l) == 0 {
+		delete(m, board)
+		return
+	}
+	m[board] = l
+}
+
+// GetMemoryMap 电路板可写的内存分布，没有单独载入工程文件时用 AllBoards 的
+func GetMemoryMap(board uint8) Regions {
+	return getMap(memMap.m, board)
+}
+
+// GetReadableMap 电路板读得到的内存分布
+func GetReadableMap(board uint8) Regions {
+	return getMap(memMap.r, board)
+}
+
+func getMap(m map[uint8]Regions, board uint8) Regions {
+	memMap.RLock()
+	defer memMap.RUnlock()
+	if l, ok := m[board]; ok {
+		return l
+	}
+	if l, ok := m[variable.AllBoards]; ok {
+		return l
+	}
+	return defaultMap
+}
+
+// ClearMemoryMap 卸下所有电路板的内存分布，切换工程时用
+func ClearMemoryMap() {
+	memMap.Lock()
+	defer memMap.Unlock()
+	memMap.m = make(map[uint8]Regions)
+	memMap.r = make(map[uint8]Regions)
+}
+
+// 用户填写的地址须落在某段可写的内存中，长度为 n 的值首尾都在同一段里
+func CheckAddr(board uint8, addr uint64, n int) (RegionT, error) {
+	return checkIn(GetMemoryMap(board), addr, n)
+}
+
+// CheckReadAddr 同 CheckAddr，只读一下的话常量所在的节也行
+func CheckReadAddr(board uint8, addr uint64, n int) (RegionT, error) {
+	return checkIn(GetReadableMap(board), addr, n)
+}
+
+// 一个变量不会跨在两段内存上，哪怕它们首尾相连
+func checkIn(l Regions, addr uint64, n int) (RegionT, error) {
+	r, ok := l.Find(addr)
+	if !ok {
+		return r, ErrAddrOutOfRange
+	}
+	if n > 1 && !r.Contains(addr+uint64(n)-1) {
+		return r, ErrAddrOutOfRange
+	}
+	return r, nil
+}
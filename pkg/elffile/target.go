@@ -0,0 +1,87 @@
+package elffile
+
+import (
+	"debug/elf"
+	"errors"
+)
+
+// 一段可以观察的内存，左闭右开
+type RegionT struct {
+	Name  string
+	Start uint64
+	End   uint64
+}
+
+// 是否住在这里
+func (r RegionT) Contains(addr uint64) bool {
+	return addr >= r.Start && addr < r.End
+}
+
+type Regions []RegionT
+
+// 找到住址所在的那段内存，协议只有 4 字节地址，再远也去不了
+func (l Regions) Find(addr uint64) (RegionT, bool) {
+	if addr > 0xFFFFFFFF {
+		return RegionT{}, false
+	}
+	for _, r := range l {
+		if r.Contains(addr) {
+			return r, true
+		}
+	}
+	return RegionT{}, false
+}
+
+// 目标平台：认得的 ELF 类别与架构、地址宽度和可以观察的内存
+type TargetT struct {
+	Name      string
+	Class     elf.Class
+	Machine   []elf.Machine
+	AddrBytes int
+	RAM       Regions
+}
+
+var Targets = []TargetT{
+	{
+		Name:      "ARM Cortex-M",
+		Class:     elf.ELFCLASS32,
+		Machine:   []elf.Machine{elf.EM_ARM},
+		AddrBytes: 4,
+		RAM:       Regions{{Name: "SRAM", Start: 0x20000000, End: 0x80000000}},
+	},
+	{
+		Name:      "RISC-V 32",
+		Class:     elf.ELFCLASS32,
+		Machine:   []elf.Machine{elf.EM_RISCV},
+		AddrBytes: 4,
+		RAM: Regions{
+			{Name: "SRAM", Start: 0x20000000, End: 0x30000000},
+			{Name: "DRAM", Start: 0x3FC80000, End: 0x3FCE0000}, // ESP32-C3
+			{Name: "RAM", Start: 0x80000000, End: 0x90000000},
+		},
+	},
+	{
+		Name:      "x86-64 SIL",
+		Class:     elf.ELFCLASS64,
+		Machine:   []elf.Machine{elf.EM_X86_64},
+		AddrBytes: 8,
+		RAM:       Regions{{Name: "RAM", Start: 0x400000, End: 0x100000000}},
+	},
+}
+
+var errNoTarget = errors.New("not valid ELF")
+
+// 按 ELF 头认出目标平台
+func TargetOf(h elf.FileHeader) (TargetT, error) {
+	for _, t := range Targets {
+		if t.Class != h.Class {
+			continue
+		}
+		for _, m := range t.Machine {
+			if m == h.Machine {
+				return t, nil
+			}
+		}
+	}
+	return TargetT{}, errNoTarget
+}
@@ -0,0 +1,15 @@
+struct pos {
+	float x;
+	int y;
+};
+
+static int count;
+int speed = 3;
+struct pos g_pos;
+
+int chassis_step(void)
+{
+	static int calls;
+	calls++;
+	return count++ + speed;
+}
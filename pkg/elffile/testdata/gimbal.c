@@ -0,0 +1,10 @@
+static int count;
+static float yaw;
+
+int chassis_step(void);
+
+int main(void)
+{
+	yaw = 1.5f;
+	return count++ + chassis_step();
+}
@@ -2,6 +2,7 @@ package elffile
 
 import (
 	"os"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -9,49 +10,171 @@ import (
 	"github.com/scutrobotlab/asuwave/internal/variable"
 )
 
-var watcher *fsnotify.Watcher
-var watchList []string
+// WatchT 是一个监视中的工程文件，Board 为 variable.AllBoards 时对所有电路板适用
+type WatchT struct {
+	Board uint8
+	Path  string
+}
+
+// 每块电路板至多监视一个工程文件
+var watchList = struct {
+	sync.Mutex
+	watcher *fsnotify.Watcher // FileWatch 启动前为 nil
+	l       []WatchT
+}{l: []WatchT{}}
 
 var ChFileWrite chan string = make(chan string, 10)
 var ChFileError chan string = make(chan string, 10)
-var ChFileWatch chan string = make(chan string, 10)
 
-func GetWatchList() []string {
-	glog.V(2).Infoln("Get: ", watchList)
-	return watchList
+func GetWatchList() []WatchT {
+	watchList.Lock()
+	defer watchList.Unlock()
+	glog.V(2).Infoln("Get: ", watchList.l)
+	return append([]WatchT{}, watchList.l...)
+}
+
+// Load 读入工程文件，作为电路板 board 的工程变量和内存区域
+func Load(board uint8, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return LoadFile(board, file)
+}
+
+func LoadFile(board uint8, file *os.File) error {
+	f, err := Check(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	projs, err := ReadVariable(f)
+	if err != nil {
+		return err
+	}
+	variable.SetAllProj(board, projs)
+	SetMemoryMap(board, MemoryMap(f))
+	SetReadableMap(board, ReadableMap(f))
+	return nil
+}
+
+// Watch 监视电路板 board 的工程文件，替换它原来监视的
+func Watch(board uint8, name string) error {
+	watchList.Lock()
+	defer watchList.Unlock()
+	l := []WatchT{}
+	for _, w := range watchList.l {
+		if w.Board != board {
+			l = append(l, w)
+		}
+	}
+	watchList.l = append(l, WatchT{board, name})
+	glog.Infoln("watch: ", board, name)
+	return syncWatcher()
+}
+
+// Unwatch 不再监视电路板 board 的工程文件
+func Unwatch(board uint8) error {
+	watchList.Lock()
+	defer watchList.Unlock()
+	l := []WatchT{}
+	for _, w := range watchList.l {
+		if w.Board != board {
+			l = append(l, w)
+		}
+	}
+	watchList.l = l
+	return syncWatcher()
 }
 
 func RemoveWathcer() error {
-	l := watcher.WatchList()
-	for _, p := range l {
-		err := watcher.Remove(p)
-		if err != nil {
+	watchList.Lock()
+	defer watchList.Unlock()
+	watchList.l = []WatchT{}
+	glog.V(2).Infoln("clear watcher")
+	return syncWatcher()
+}
+
+// Unload 卸下电路板 board 的工程文件：不再监视它，工程变量与内存区域一并清除
+func Unload(board uint8) error {
+	variable.ClearProj(board)
+	SetMemoryMap(board, nil)
+	SetReadableMap(board, nil)
+	return Unwatch(board)
+}
+
+// UnloadAll 卸下所有电路板的工程文件
+func UnloadAll() error {
+	variable.ClearAllProj()
+	ClearMemoryMap()
+	return RemoveWathcer()
+}
+
+// syncWatcher 让 watcher 监视的文件与 watchList 一致，须在锁内调用
+func syncWatcher() error {
+	if watchList.watcher == nil {
+		return nil
+	}
+	want := map[string]bool{}
+	for _, w := range watchList.l {
+		want[w.Path] = true
+	}
+	for _, p := range watchList.watcher.WatchList() {
+		if want[p] {
+			delete(want, p)
+			continue
+		}
+		if err := watchList.watcher.Remove(p); err != nil {
+			return err
+		}
+	}
+	for p := range want {
+		if err := watchList.watcher.Add(p); err != nil {
 			return err
 		}
 	}
-	glog.V(2).Infoln("clear watcher")
 	return nil
 }
 
+// boardsOf 监视着文件 name 的电路板
+func boardsOf(name string) []uint8 {
+	watchList.Lock()
+	defer watchList.Unlock()
+	l := []uint8{}
+	for _, w := range watchList.l {
+		if w.Path == name {
+			l = append(l, w.Board)
+		}
+	}
+	return l
+}
+
 func FileWatch() {
-	var err error
-	watcher, err = fsnotify.NewWatcher()
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		glog.Errorln(err.Error())
 		return
 	}
 	defer watcher.Close()
-	watchdog := 0
-	lastEventName := ""
+
+	watchList.Lock()
+	watchList.watcher = watcher
+	if err := syncWatcher(); err != nil {
+		glog.Errorln(err.Error())
+	}
+	watchList.Unlock()
+	defer func() {
+		watchList.Lock()
+		watchList.watcher = nil
+		watchList.Unlock()
+	}()
+
+	// 各个文件分别等写完
+	watchdog := map[string]int{}
 	for {
 		select {
-		case file := <-ChFileWatch:
-			for _, f := range watcher.WatchList() {
-				watcher.Remove(f)
-			}
-			glog.Infoln("watch: ", file)
-			watchList = []string{file}
-			watcher.Add(file)
 		case event, ok := <-watcher.Events:
 			if !ok {
 				glog.Warningln("Event not ok")
@@ -59,45 +182,38 @@ func FileWatch() {
 			}
 			glog.V(2).Infoln("file event:", event)
 			if event.Op&fsnotify.Write == fsnotify.Write {
-				lastEventName = event.Name
-				watchdog = 0
+				watchdog[event.Name] = 0
 			}
 		case err, ok := <-watcher.Errors:
 			if !ok {
 				glog.Warningln("Error not ok")
 				return
 			}
-			lastEventName = ""
+			watchdog = map[string]int{}
 			ChFileError <- err.Error()
 			glog.Errorln("error:", err)
 		case <-time.After(200 * time.Millisecond):
-			if lastEventName != "" && watchdog < 5 {
-				watchdog++
-			} else if lastEventName != "" && watchdog == 5 {
-				glog.Infoln("file write done:", lastEventName)
-
-				file, err := os.Open(lastEventName)
-				if err != nil {
-					glog.Errorln("file open:", err)
-					return
+			for name, n := range watchdog {
+				if n < 5 {
+					watchdog[name]++
+					continue
 				}
+				delete(watchdog, name)
+				glog.Infoln("file write done:", name)
 
-				f, err := Check(file)
-				if err != nil {
-					glog.Errorln("file check:", err)
-					return
+				loaded := false
+				for _, board := range boardsOf(name) {
+					if err := Load(board, name); err != nil {
+						glog.Errorln("file load:", err)
+						ChFileError <- err.Error()
+						continue
+					}
+					loaded = true
 				}
-				defer f.Close()
-
-				projs, err := ReadVariable(f)
-				if err != nil {
-					glog.Errorln("file read:", err)
-					return
+				if loaded {
+					variable.UpdateByProj()
+					ChFileWrite <- name
 				}
-				variable.SetAllProj(projs)
-				variable.UpdateByProj()
-				ChFileWrite <- lastEventName
-				watchdog++
 			}
 		}
 	}
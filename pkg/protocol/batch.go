@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/scutrobotlab/asuwave/pkg/slip"
+)
+
+// 批量帧：一帧带上同一时刻多个订阅变量的值，只在 v2 中使用：
+// version, seq, board, act, count, tick[4], count 个 {addr[4], length, data[length]}, crc[2], '\n'
+// 其中 length 可达 MaxValueLen，整个结构体或数组因此能在同一时刻采下
+const (
+	SubscribeBatch Act = 0x0b // 订阅的数据，批量
+	MaxBatch           = 32   // 一帧最多带的变量数
+)
+
+// 握手时 data[1] 中的能力位，上位机列出想要的，单片机回应接受的
+const (
+	CapBatch uint8 = 1 << iota // 批量帧
+)
+
+// 批量帧中除变量外的字节数
+const batchOverhead = 2 + 1 + 1 + 1 + 4 + 2 + 1
+
+// MaxBatchFrameLen 是 SLIP 编码后最长的批量帧，每个字节都转义时翻倍，再加上首尾的 END
+const MaxBatchFrameLen = 2*(batchOverhead+MaxBatch*(5+MaxValueLen)) + 2
+
+// EncodeBatch 把同一时刻的多个订阅回应编码为批量帧，未经 SLIP 编码
+func EncodeBatch(board uint8, tick uint32, seq uint8, l []Response) []byte {
+	b := make([]byte, 0, batchOverhead+len(l)*(5+MaxValueLen))
+	var u [4]byte
+	b = append(b, V2, seq, board, byte(SubscribeBatch), byte(len(l)))
+	binary.LittleEndian.PutUint32(u[:], tick)
+	b = append(b, u[:]...)
+	for _, r := range l {
+		binary.LittleEndian.PutUint32(u[:], r.Addr)
+		b = append(b, u[:]...)
+		b = append(b, r.Length)
+		b = append(b, r.Value()[:r.Length]...)
+	}
+	crc := CRC16(b)
+	return append(b, byte(crc), byte(crc>>8), Terminator)
+}
+
+// PackBatch 把批量帧编码为 SLIP 帧
+func PackBatch(board uint8, tick uint32, seq uint8, l []Response) []byte {
+	return slip.Pack(EncodeBatch(board, tick, seq, l))
+}
+
+// isBatch 判断是不是批量帧
+func isBatch(b []byte) bool {
+	return len(b) >= batchOverhead && b[0] == V2 && Act(b[3]) == SubscribeBatch
+}
+
+// DecodeBatch 从未经 SLIP 编码的批量帧解出各变量的订阅回应，它们共用同一个时间戳
+func DecodeBatch(b []byte) (Frame, error) {
+	n := len(b)
+	if n < batchOverhead {
+		return Frame{}, fmt.Errorf("%w: %d", ErrLength, n)
+	}
+	if b[n-1] != Terminator {
+		return Frame{}, fmt.Errorf("%w: 0x%02x", ErrTerminator, b[n-1])
+	}
+	if b[0] != V2 {
+		return Frame{}, fmt.Errorf("%w: %d", ErrVersion, b[0])
+	}
+	if crc := binary.LittleEndian.Uint16(b[n-3 : n-1]); crc != CRC16(b[:n-3]) {
+		return Frame{}, fmt.Errorf("%w: 0x%04x", ErrCRC, crc)
+	}
+	if Act(b[3]) != SubscribeBatch {
+		return Frame{}, fmt.Errorf("%w: 0x%02x", ErrAct, b[3])
+	}
+
+	f := Frame{
+		Response: Response{
+			Board:  b[2],
+			Act:    SubscribeBatch,
+			Length: b[4],
+			Tick:   binary.LittleEndian.Uint32(b[5:9]),
+		},
+		Version: V2,
+		Seq:     b[1],
+		Batch:   []Response{},
+	}
+	if f.Length > MaxBatch {
+		return Frame{}, fmt.Errorf("%w: %d variables", ErrLength, f.Length)
+	}
+	body := b[9 : n-3]
+	for i := 0; i < int(f.Length); i++ {
+		if len(body) < 5 {
+			return Frame{}, fmt.Errorf("%w: batch truncated", ErrLength)
+		}
+		r := Response{
+			Board:  f.Board,
+			Act:    SubscribeReturn,
+			Addr:   binary.LittleEndian.Uint32(body[0:4]),
+			Length: body[4],
+			Tick:   f.Tick,
+		}
+		if err := checkLength(r.Length, MaxValueLen); err != nil {
+			return Frame{}, err
+		}
+		body = body[5:]
+		if len(body) < int(r.Length) {
+			return Frame{}, fmt.Errorf("%w: batch truncated", ErrLength)
+		}
+		copy(r.Data[:], body[:r.Length])
+		if r.Length > DataLen {
+			r.Wide = append([]byte{}, body[:r.Length]...)
+		}
+		body = body[r.Length:]
+		f.Batch = append(f.Batch, r)
+	}
+	if len(body) != 0 {
+		return Frame{}, fmt.Errorf("%w: %d bytes left in batch", ErrLength, len(body))
+	}
+	return f, nil
+}
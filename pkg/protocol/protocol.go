@@ -0,0 +1,245 @@
+/*
+我们之间的约定，只写在这一处
+*/
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/scutrobotlab/asuwave/pkg/slip"
+)
+
+// 数据包长度与结尾
+const (
+	RequestLen  = 16   // 发给单片机的数据包长度
+	ResponseLen = 20   // 单片机发来的数据包长度
+	DataLen     = 8    // 数据包中数据最长字节数
+	MaxValueLen = 64   // 一个值最长字节数，超过 DataLen 的只能订阅，由批量帧传回
+	Terminator  = '\n' // 数据包结尾
+)
+
+// 校验失败的原因
+var (
+	ErrLength     = errors.New("protocol: bad length")
+	ErrTerminator = errors.New("protocol: bad terminator")
+	ErrAct        = errors.New("protocol: unknown act")
+	ErrDataLength = errors.New("protocol: bad data length")
+)
+
+// Act 是请求、回应或错误的代号
+type Act uint8
+
+const (
+	_                 Act = iota
+	Subscribe             // 订阅
+	SubscribeReturn       // 订阅的数据
+	Unsubscribe           // 取消订阅
+	UnsubscribeReturn     // 取消订阅的回应
+	Read                  // 读取一次
+	ReadReturn            // 读取的回应
+	Write                 // 写入
+	WriteReturn           // 写入的回应
+)
+
+// 单片机的错误回应
+const (
+	NoSuchAddrReg Act = 0xf9 + iota // 取消订阅未订阅的地址
+	FullAddr                        // 订阅变量已达上限
+	NoSuchDataNum                   // 不支持的数据长度
+	NoSuchAddr                      // 不支持的地址
+	NoSuchAct                       // 不支持的请求代号
+	NoSuchBoard                     // 不支持的单片机代号
+)
+
+// IsRequest 判断是不是发给单片机的请求代号
+func (a Act) IsRequest() bool {
+	switch a {
+	case Subscribe, Unsubscribe, Read, Write, Hello:
+		return true
+	}
+	return false
+}
+
+// IsResponse 判断是不是单片机的回应代号，含错误
+func (a Act) IsResponse() bool {
+	switch a {
+	case SubscribeReturn, UnsubscribeReturn, ReadReturn, WriteReturn, HelloReturn:
+		return true
+	}
+	return a.IsError()
+}
+
+// IsError 判断是不是单片机的错误代号
+func (a Act) IsError() bool {
+	return a >= NoSuchAddrReg && a <= NoSuchBoard
+}
+
+// Request 是发给单片机的数据包：
+// board, act, length, addr[4], data[8], '\n'，多字节均为小端
+type Request struct {
+	Board  uint8
+	Act    Act
+	Length uint8
+	Addr   uint32
+	Data   [DataLen]byte
+}
+
+// Response 是单片机发来的数据包，经 SLIP 编码：
+// board, act, length, addr[4], data[8], tick[4], '\n'，多字节均为小端
+type Response struct {
+	Board  uint8
+	Act    Act
+	Length uint8
+	Addr   uint32
+	Data   [DataLen]byte
+	Tick   uint32
+	Wide   []byte // 超过 DataLen 的值，只出现在批量帧中
+}
+
+// maxLength 不带数据的请求和回应，长度可以超过 DataLen
+func (a Act) maxLength() uint8 {
+	if a == Subscribe || a == Unsubscribe || a == UnsubscribeReturn || a.IsError() {
+		return MaxValueLen
+	}
+	return DataLen
+}
+
+func checkLength(length, max uint8) error {
+	if length > max {
+		return fmt.Errorf("%w: %d", ErrDataLength, length)
+	}
+	return nil
+}
+
+// Validate 校验请求
+func (r Request) Validate() error {
+	if !r.Act.IsRequest() {
+		return fmt.Errorf("%w: 0x%02x", ErrAct, uint8(r.Act))
+	}
+	return checkLength(r.Length, r.Act.maxLength())
+}
+
+// Validate 校验回应
+func (r Response) Validate() error {
+	if !r.Act.IsResponse() {
+		return fmt.Errorf("%w: 0x%02x", ErrAct, uint8(r.Act))
+	}
+	return checkLength(r.Length, r.Act.maxLength())
+}
+
+// Value 回应带回的值，宽的值在 Wide 中
+func (r Response) Value() []byte {
+	if r.Wide != nil {
+		return r.Wide
+	}
+	return r.Data[:]
+}
+
+// Encode 把请求编码为数据包
+func (r Request) Encode() []byte {
+	b := make([]byte, RequestLen)
+	b[0] = r.Board
+	b[1] = byte(r.Act)
+	b[2] = r.Length
+	binary.LittleEndian.PutUint32(b[3:7], r.Addr)
+	copy(b[7:15], r.Data[:])
+	b[15] = Terminator
+	return b
+}
+
+// DecodeRequest 从数据包解出请求
+func DecodeRequest(b []byte) (Request, error) {
+	if len(b) != RequestLen {
+		return Request{}, fmt.Errorf("%w: %d, want %d", ErrLength, len(b), RequestLen)
+	}
+	if b[RequestLen-1] != Terminator {
+		return Request{}, fmt.Errorf("%w: 0x%02x", ErrTerminator, b[RequestLen-1])
+	}
+	r := Request{
+		Board:  b[0],
+		Act:    Act(b[1]),
+		Length: b[2],
+		Addr:   binary.LittleEndian.Uint32(b[3:7]),
+	}
+	copy(r.Data[:], b[7:15])
+	return r, r.Validate()
+}
+
+// Encode 把回应编码为数据包，未经 SLIP 编码
+func (r Response) Encode() []byte {
+	b := make([]byte, ResponseLen)
+	b[0] = r.Board
+	b[1] = byte(r.Act)
+	b[2] = r.Length
+	binary.LittleEndian.PutUint32(b[3:7], r.Addr)
+	copy(b[7:15], r.Data[:])
+	binary.LittleEndian.PutUint32(b[15:19], r.Tick)
+	b[19] = Terminator
+	return b
+}
+
+// DecodeResponse 从未经 SLIP 编码的数据包解出回应
+func DecodeResponse(b []byte) (Response, error) {
+	if len(b) != ResponseLen {
+		return Response{}, fmt.Errorf("%w: %d, want %d", ErrLength, len(b), ResponseLen)
+	}
+	if b[ResponseLen-1] != Terminator {
+		return Response{}, fmt.Errorf("%w: 0x%02x", ErrTerminator, b[ResponseLen-1])
+	}
+	r := Response{
+		Board:  b[0],
+		Act:    Act(b[1]),
+		Length: b[2],
+		Addr:   binary.LittleEndian.Uint32(b[3:7]),
+		Tick:   binary.LittleEndian.Uint32(b[15:19]),
+	}
+	copy(r.Data[:], b[7:15])
+	return r, r.Validate()
+}
+
+// Pack 把回应编码为 SLIP 帧
+func (r Response) Pack() []byte {
+	return slip.Pack(r.Encode())
+}
+
+// Unpack 从收到的字节流中解出所有完整的帧，v1 与 v2 均可，返回解出的帧、
+// 解不开的帧的错误，以及留待下次的残余字节
+func Unpack(stream []byte) ([]Frame, []error, []byte) {
+	ends := []int{}
+	for i, d := range stream {
+		if d == slip.END {
+			ends = append(ends, i)
+		}
+	}
+	if len(ends) == 0 {
+		return []Frame{}, nil, []byte{}
+	}
+
+	l := []Frame{}
+	errs := []error{}
+	for i := 1; i < len(ends); i++ {
+		// 帧间的空隙，或是比最短的批量帧还短的碎片；只有一个 1 字节值的批量帧比 v1 数据包还短
+		if ends[i]-ends[i-1] <= batchOverhead {
+			continue
+		}
+		pdu, err := slip.Unpack(stream[ends[i-1] : ends[i]+1])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r, err := DecodeFrame(pdu)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l = append(l, r)
+	}
+
+	// 最后一个 END 可能是下一帧的开始
+	f := ends[len(ends)-1]
+	rest := make([]byte, len(stream)-f)
+	copy(rest, stream[f:])
+	return l, errs, rest
+}
@@ -0,0 +1,257 @@
+package protocol_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/scutrobotlab/asuwave/pkg/protocol"
+	"github.com/scutrobotlab/asuwave/pkg/slip"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	r := protocol.Request{
+		Board:  1,
+		Act:    protocol.Write,
+		Length: 4,
+		Addr:   0x20123456,
+		Data:   [8]byte{0x00, 0x00, 0x04, 0xc1},
+	}
+	want := []byte{0x1, 0x7, 0x4, 0x56, 0x34, 0x12, 0x20, 0x0, 0x0, 0x4, 0xc1, 0x0, 0x0, 0x0, 0x0, 0xa}
+	b := r.Encode()
+	if !bytes.Equal(b, want) {
+		t.Fatalf("Encode\n\thave: %#v\n\twant: %#v", b, want)
+	}
+	got, err := protocol.DecodeRequest(b)
+	if err != nil || got != r {
+		t.Errorf("DecodeRequest: %#v %v", got, err)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	r := protocol.Response{
+		Board:  2,
+		Act:    protocol.SubscribeReturn,
+		Length: 8,
+		Addr:   0x200004a8,
+		Data:   [8]byte{1, 2, 3, 4, 5, 6, 7, slip.END},
+		Tick:   0xe241,
+	}
+	b := r.Encode()
+	if len(b) != protocol.ResponseLen || b[19] != '\n' {
+		t.Fatalf("Encode: %#v", b)
+	}
+	got, err := protocol.DecodeResponse(b)
+	if err != nil || !reflect.DeepEqual(got, r) {
+		t.Errorf("DecodeResponse: %#v %v", got, err)
+	}
+
+	// 两帧连在一起，后面再跟半帧
+	p := r.Pack()
+	stream := append(append(append([]byte{}, p...), p...), p[:5]...)
+	l, errs, rest := protocol.Unpack(stream)
+	if len(l) != 2 || len(errs) != 0 || !reflect.DeepEqual(l[0].Response, r) || !reflect.DeepEqual(l[1].Response, r) || l[0].Version != protocol.V1 {
+		t.Errorf("Unpack: %v %v", l, errs)
+	}
+	if !bytes.Equal(rest, p[:5]) {
+		t.Errorf("rest %#v", rest)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	req := protocol.Request{Board: 1, Act: protocol.Read, Length: 4}.Encode()
+	res := protocol.Response{Board: 1, Act: protocol.ReadReturn, Length: 4}.Encode()
+
+	mod := func(b []byte, i int, v byte) []byte {
+		c := append([]byte{}, b...)
+		c[i] = v
+		return c
+	}
+	sub := mod(req, 1, byte(protocol.Subscribe))
+	cases := []struct {
+		name string
+		err  error
+		f    func() error
+	}{
+		{"request short", protocol.ErrLength, func() error { _, err := protocol.DecodeRequest(req[:15]); return err }},
+		{"request terminator", protocol.ErrTerminator, func() error { _, err := protocol.DecodeRequest(mod(req, 15, 0)); return err }},
+		{"request act", protocol.ErrAct, func() error { _, err := protocol.DecodeRequest(mod(req, 1, byte(protocol.ReadReturn))); return err }},
+		{"request data length", protocol.ErrDataLength, func() error { _, err := protocol.DecodeRequest(mod(req, 2, 9)); return err }},
+		{"request wide subscribe", nil, func() error { _, err := protocol.DecodeRequest(mod(sub, 2, 64)); return err }},
+		{"request too wide", protocol.ErrDataLength, func() error { _, err := protocol.DecodeRequest(mod(sub, 2, 65)); return err }},
+		{"response long", protocol.ErrLength, func() error { _, err := protocol.DecodeResponse(append(res, 0)); return err }},
+		{"response terminator", protocol.ErrTerminator, func() error { _, err := protocol.DecodeResponse(mod(res, 19, 0)); return err }},
+		{"response act", protocol.ErrAct, func() error { _, err := protocol.DecodeResponse(mod(res, 1, byte(protocol.Write))); return err }},
+		{"response error act", nil, func() error { _, err := protocol.DecodeResponse(mod(res, 1, byte(protocol.NoSuchBoard))); return err }},
+	}
+	for _, c := range cases {
+		if err := c.f(); !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	// CRC-16/CCITT-FALSE 的校验值
+	if c := protocol.CRC16([]byte("123456789")); c != 0x29b1 {
+		t.Errorf("CRC16 = 0x%04x, want 0x29b1", c)
+	}
+}
+
+func TestV2(t *testing.T) {
+	req := protocol.Request{Board: 1, Act: protocol.Write, Length: 4, Addr: 0x20000000, Data: [8]byte{1, 2, 3, 4}}
+	b := req.EncodeV2(7)
+	if len(b) != protocol.RequestV2Len || b[0] != protocol.V2 || b[1] != 7 {
+		t.Fatalf("EncodeV2: %#v", b)
+	}
+	got, seq, err := protocol.DecodeRequestV2(b)
+	if err != nil || got != req || seq != 7 {
+		t.Errorf("DecodeRequestV2: %#v %d %v", got, seq, err)
+	}
+
+	res := protocol.Response{Board: 1, Act: protocol.SubscribeReturn, Length: 4, Addr: 0x20000000, Tick: 100}
+	p1 := res.PackV2(254)
+	p2 := res.PackV2(255)
+	l, errs, _ := protocol.Unpack(append(append(append([]byte{}, p1...), res.Pack()...), p2...))
+	if len(errs) != 0 || len(l) != 3 {
+		t.Fatalf("Unpack: %v %v", l, errs)
+	}
+	if l[0].Version != protocol.V2 || l[0].Seq != 254 || l[1].Version != protocol.V1 || l[2].Seq != 255 || !reflect.DeepEqual(l[2].Response, res) {
+		t.Errorf("Unpack: %+v", l)
+	}
+
+	// 线上的干扰
+	bad := res.EncodeV2(3)
+	bad[10] ^= 0x10
+	if _, err := protocol.DecodeFrame(bad); !errors.Is(err, protocol.ErrCRC) {
+		t.Errorf("noise: %v", err)
+	}
+	bad = res.EncodeV2(3)
+	bad[0] = 3
+	if _, err := protocol.DecodeFrame(bad); !errors.Is(err, protocol.ErrVersion) {
+		t.Errorf("version: %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	l := []protocol.Response{
+		{Board: 1, Act: protocol.SubscribeReturn, Addr: 0x20000000, Length: 4, Data: [8]byte{1, 2, 3, 4}, Tick: 99},
+		{Board: 1, Act: protocol.SubscribeReturn, Addr: 0x20000010, Length: 8, Data: [8]byte{8, 7, 6, 5, 4, 3, 2, slip.END}, Tick: 99},
+		{Board: 1, Act: protocol.SubscribeReturn, Addr: 0x20000020, Length: 1, Data: [8]byte{slip.ESC}, Tick: 99},
+		{Board: 1, Act: protocol.SubscribeReturn, Addr: 0x20000030, Length: 12, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Wide: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, slip.END}, Tick: 99},
+	}
+	single := l[0].PackV2(4)
+	stream := append(append([]byte{}, protocol.PackBatch(1, 99, 3, l)...), single...)
+	frames, errs, _ := protocol.Unpack(stream)
+	if len(errs) != 0 || len(frames) != 2 {
+		t.Fatalf("Unpack: %v %v", frames, errs)
+	}
+	got := frames[0].Responses()
+	if len(got) != len(l) || frames[0].Seq != 3 {
+		t.Fatalf("batch %+v", frames[0])
+	}
+	for i := range l {
+		if !reflect.DeepEqual(got[i], l[i]) {
+			t.Errorf("batch[%d]\n\thave: %+v\n\twant: %+v", i, got[i], l[i])
+		}
+	}
+	if r := frames[1].Responses(); len(r) != 1 || !reflect.DeepEqual(r[0], l[0]) {
+		t.Errorf("single %+v", frames[1])
+	}
+
+	// 只有一个 1 或 2 字节值的批量帧，比 v1 数据包还短
+	for _, n := range []uint8{1, 2} {
+		small := []protocol.Response{{Board: 1, Act: protocol.SubscribeReturn, Addr: 0x20000040, Length: n, Data: [8]byte{7, 1}, Tick: 99}}
+		frames, errs, _ := protocol.Unpack(protocol.PackBatch(1, 99, 5, small))
+		if len(errs) != 0 || len(frames) != 1 {
+			t.Fatalf("Unpack %d-byte batch: %v %v", n, frames, errs)
+		}
+		if r := frames[0].Responses(); len(r) != 1 || r[0].Length != n || !bytes.Equal(r[0].Value()[:n], small[0].Data[:n]) {
+			t.Errorf("%d-byte batch %+v", n, frames[0])
+		}
+	}
+
+	// 截断的批量帧
+	b := protocol.EncodeBatch(1, 99, 3, l)
+	b[4] = byte(len(l) + 1)
+	crc := protocol.CRC16(b[:len(b)-3])
+	b[len(b)-3], b[len(b)-2] = byte(crc), byte(crc>>8)
+	if _, err := protocol.DecodeBatch(b); !errors.Is(err, protocol.ErrLength) {
+		t.Errorf("bad count: %v", err)
+	}
+}
+
+func FuzzDecodeRequest(f *testing.F) {
+	f.Add(protocol.Request{Board: 1, Act: protocol.Subscribe, Length: 4, Addr: 0x20000000}.Encode())
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r, err := protocol.DecodeRequest(b)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(r.Encode(), b) {
+			t.Fatalf("round trip\n\thave: %#v\n\twant: %#v", r.Encode(), b)
+		}
+	})
+}
+
+func FuzzDecodeResponse(f *testing.F) {
+	f.Add(protocol.Response{Board: 1, Act: protocol.SubscribeReturn, Length: 4, Addr: 0x20000000, Tick: 10}.Encode())
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r, err := protocol.DecodeResponse(b)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(r.Encode(), b) {
+			t.Fatalf("round trip\n\thave: %#v\n\twant: %#v", r.Encode(), b)
+		}
+	})
+}
+
+func FuzzDecodeFrame(f *testing.F) {
+	res := protocol.Response{Board: 1, Act: protocol.ReadReturn, Length: 8, Addr: 0x20000000, Tick: 10}
+	f.Add(res.Encode())
+	f.Add(res.EncodeV2(1))
+	f.Add(protocol.EncodeBatch(1, 10, 2, []protocol.Response{res, {Addr: 0x20000004, Length: 2}}))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r, err := protocol.DecodeFrame(b)
+		if err != nil {
+			return
+		}
+		e := r.Encode()
+		if r.Act == protocol.SubscribeBatch {
+			e = protocol.EncodeBatch(r.Board, r.Tick, r.Seq, r.Batch)
+		} else if r.Version == protocol.V2 {
+			e = r.EncodeV2(r.Seq)
+		}
+		if !bytes.Equal(e, b) {
+			t.Fatalf("round trip\n\thave: %#v\n\twant: %#v", e, b)
+		}
+	})
+}
+
+func FuzzUnpack(f *testing.F) {
+	p := protocol.Response{Board: 1, Act: protocol.SubscribeReturn, Length: 4, Addr: 0x200000c0, Tick: 0xc0}.Pack()
+	f.Add(p)
+	f.Add(append(append([]byte{0x0a}, p...), p[:7]...))
+	f.Add([]byte{slip.END, slip.ESC, slip.END})
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		l, _, rest := protocol.Unpack(stream)
+		for _, f := range l {
+			for _, r := range f.Responses() {
+				if r.Validate() != nil {
+					t.Fatalf("invalid response %#v", r)
+				}
+			}
+		}
+		if len(rest) > len(stream) {
+			t.Fatalf("rest %d longer than stream %d", len(rest), len(stream))
+		}
+		if len(rest) != 0 && rest[0] != slip.END {
+			t.Fatalf("rest %#v not start with END", rest)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/scutrobotlab/asuwave/pkg/slip"
+)
+
+// 协议版本。v2 在 v1 的前面加上版本号和序号，结尾前加上 CRC-16：
+// 请求为 version, seq, board, act, length, addr[4], data[8], crc[2], '\n'，不经 SLIP 编码；
+// 回应为 version, seq, board, act, length, addr[4], data[8], tick[4], crc[2], '\n'，经 SLIP 编码。
+// CRC 为 CRC-16/CCITT-FALSE，覆盖 crc 之前的所有字节，小端
+const (
+	V1 uint8 = 1
+	V2 uint8 = 2
+
+	RequestV2Len  = RequestLen + 4
+	ResponseV2Len = ResponseLen + 4
+)
+
+// 握手：打开串口时以 v1 发出 Hello，data[0] 为上位机支持的最高版本，data[1] 为想要的能力；
+// 支持 v2 的单片机以 v1 回应 HelloReturn，data[0] 为选定的版本，data[1] 为接受的能力，此后双方都用该版本
+const (
+	Hello       Act = 0x09
+	HelloReturn Act = 0x0a
+)
+
+var (
+	ErrCRC     = errors.New("protocol: bad crc")
+	ErrVersion = errors.New("protocol: unknown version")
+)
+
+// CRC16 计算 CRC-16/CCITT-FALSE
+func CRC16(b []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// wrapV2 给 v1 数据包（不含结尾）加上版本号、序号和 CRC
+func wrapV2(body []byte, seq uint8) []byte {
+	b := make([]byte, 0, len(body)+5)
+	b = append(b, V2, seq)
+	b = append(b, body...)
+	crc := CRC16(b)
+	return append(b, byte(crc), byte(crc>>8), Terminator)
+}
+
+// unwrapV2 校验 v2 数据包，返回序号和 v1 数据包
+func unwrapV2(b []byte, n int) ([]byte, uint8, error) {
+	if len(b) != n {
+		return nil, 0, fmt.Errorf("%w: %d, want %d", ErrLength, len(b), n)
+	}
+	if b[n-1] != Terminator {
+		return nil, 0, fmt.Errorf("%w: 0x%02x", ErrTerminator, b[n-1])
+	}
+	if b[0] != V2 {
+		return nil, 0, fmt.Errorf("%w: %d", ErrVersion, b[0])
+	}
+	if crc := binary.LittleEndian.Uint16(b[n-3 : n-1]); crc != CRC16(b[:n-3]) {
+		return nil, 0, fmt.Errorf("%w: 0x%04x", ErrCRC, crc)
+	}
+	v1 := make([]byte, 0, n-4)
+	v1 = append(v1, b[2:n-3]...)
+	return append(v1, Terminator), b[1], nil
+}
+
+// EncodeV2 把请求编码为 v2 数据包
+func (r Request) EncodeV2(seq uint8) []byte {
+	return wrapV2(r.Encode()[:RequestLen-1], seq)
+}
+
+// DecodeRequestV2 从 v2 数据包解出请求和序号
+func DecodeRequestV2(b []byte) (Request, uint8, error) {
+	v1, seq, err := unwrapV2(b, RequestV2Len)
+	if err != nil {
+		return Request{}, 0, err
+	}
+	r, err := DecodeRequest(v1)
+	return r, seq, err
+}
+
+// EncodeV2 把回应编码为 v2 数据包，未经 SLIP 编码
+func (r Response) EncodeV2(seq uint8) []byte {
+	return wrapV2(r.Encode()[:ResponseLen-1], seq)
+}
+
+// PackV2 把回应编码为 v2 的 SLIP 帧
+func (r Response) PackV2(seq uint8) []byte {
+	return slip.Pack(r.EncodeV2(seq))
+}
+
+// DecodeResponseV2 从未经 SLIP 编码的 v2 数据包解出回应和序号
+func DecodeResponseV2(b []byte) (Response, uint8, error) {
+	v1, seq, err := unwrapV2(b, ResponseV2Len)
+	if err != nil {
+		return Response{}, 0, err
+	}
+	r, err := DecodeResponse(v1)
+	return r, seq, err
+}
+
+// Frame 是收到的一帧，v1 的帧没有序号，批量帧的各个变量在 Batch 中
+type Frame struct {
+	Response
+	Version uint8
+	Seq     uint8
+	Batch   []Response
+}
+
+// Responses 返回帧中所有的回应
+func (f Frame) Responses() []Response {
+	if f.Act == SubscribeBatch {
+		return f.Batch
+	}
+	return []Response{f.Response}
+}
+
+// DecodeFrame 从未经 SLIP 编码的数据包解出一帧，批量帧看代号，其余按长度判断版本
+func DecodeFrame(b []byte) (Frame, error) {
+	if isBatch(b) {
+		if f, err := DecodeBatch(b); err == nil || len(b) != ResponseLen {
+			return f, err
+		}
+		// 也可能是碰巧长得像的 v1 数据包
+	}
+	switch len(b) {
+	case ResponseLen:
+		r, err := DecodeResponse(b)
+		return Frame{Response: r, Version: V1}, err
+	case ResponseV2Len:
+		r, seq, err := DecodeResponseV2(b)
+		return Frame{Response: r, Version: V2, Seq: seq}, err
+	}
+	return Frame{}, fmt.Errorf("%w: %d", ErrLength, len(b))
+}
@@ -10,11 +10,11 @@ export async function getSerialCur() {
   return res;
 }
 
-export async function postSerialCur(Serial, Baud) {
-  const res = await fetchApi("/serial_cur", "POST", { Serial, Baud });
+export async function postSerialCur(Serial, Baud, Boards = []) {
+  const res = await fetchApi("/serial_cur", "POST", { Serial, Baud, Boards });
   return res;
 }
 
-export async function deleteSerialCur() {
-  return await fetchApi("/serial_cur", "DELETE");
+export async function deleteSerialCur(Serial = "") {
+  return await fetchApi("/serial_cur", "DELETE", { Serial });
 }
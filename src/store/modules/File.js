@@ -30,7 +30,7 @@ export default {
         window.console.log("Watching file: ", r);
         if (r != null) {
           state.upload = "";
-          state.path = r;
+          state.path = r.map((w) => w.Path).join(", ");
         }
       });
     },